@@ -3,12 +3,21 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config almacena toda la configuración de la aplicación
 type Config struct {
+	// Motor de base de datos: DB_DRIVER es "mysql", "sqlite" (archivo
+	// SQLITE_PATH) o "memory" (usuarios en memoria y el resto de datos en una
+	// base SQLite en memoria; nada se conserva al reiniciar)
+	DBDriver   string
+	SQLitePath string
+
 	DBUser    string
 	DBPass    string
 	DBHost    string
@@ -16,6 +25,115 @@ type Config struct {
 	DBName    string
 	APIPort   string
 	JWTSecret string
+
+	// Si el servicio aplica las migraciones pendientes al iniciar. Si no, deben
+	// aplicarse antes con el subcomando migrate.
+	AutoMigrate bool
+
+	// Firma de los JWT: JWT_ALG es HS256 (con JWT_SECRET), RS256 o EdDSA (con
+	// las claves PEM de JWT_KEYS_DIR, firmando con la clave JWT_ACTIVE_KID)
+	JWTAlgorithm string
+	JWTKeysDir   string
+	JWTActiveKID string
+
+	// Duración de los tokens de acceso (JWT) y de renovación (opacos)
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Intervalo de sincronización de la caché de tokens revocados
+	RevocationSyncInterval time.Duration
+
+	// Vigencia por defecto de los códigos de invitación
+	InvitationTTL time.Duration
+
+	// Archivo donde se guarda el código de la invitación de administrador
+	// inicial, legible solo por el usuario del servicio
+	BootstrapInvitationFile string
+
+	// URL pública del servicio, usada en los enlaces enviados por correo
+	AppBaseURL string
+
+	// Envío de correos: MAIL_DRIVER es "smtp" u "outbox" (archivos locales)
+	MailDriver    string
+	MailFrom      string
+	MailOutboxDir string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUser      string
+	SMTPPass      string
+
+	// Vigencia de los tokens de restablecimiento de contraseña
+	PasswordResetTTL time.Duration
+
+	// Vigencia de los enlaces de inicio de sesión sin contraseña
+	MagicLinkTTL time.Duration
+
+	// Hash de contraseñas: PASSWORD_HASH_ALGORITHM es "argon2id" o "bcrypt".
+	// Las contraseñas cifradas con otro algoritmo o parámetros se vuelven a
+	// cifrar al iniciar sesión.
+	PasswordHashAlgorithm string
+	Argon2Memory          int // KiB
+	Argon2Iterations      int
+	Argon2Parallelism     int
+	BcryptCost            int
+
+	// Política de contraseñas: longitud en caracteres, clases de caracteres
+	// obligatorias, si se rechazan las que contienen el nombre de usuario o el
+	// correo, cuántas contraseñas anteriores no pueden repetirse (0 desactiva
+	// el historial) y archivo de contraseñas filtradas (vacío lo desactiva)
+	PasswordMinLength        int
+	PasswordMaxLength        int
+	PasswordRequireUppercase bool
+	PasswordRequireLowercase bool
+	PasswordRequireDigit     bool
+	PasswordRequireSymbol    bool
+	PasswordDisallowUserInfo bool
+	PasswordHistory          int
+	BreachedPasswordsFile    string
+
+	// Verificación de correo: vigencia del enlace y si Login exige correo verificado
+	EmailVerificationTTL     time.Duration
+	RequireEmailVerification bool
+
+	// Cambio de correo: vigencia del enlace de confirmación enviado al correo
+	// nuevo y del enlace para deshacer el cambio enviado al anterior
+	EmailChangeTTL     time.Duration
+	EmailChangeUndoTTL time.Duration
+
+	// Autenticación en dos pasos (TOTP): emisor mostrado en las aplicaciones
+	// y vigencia del mfa_token entre los dos pasos del inicio de sesión
+	TOTPIssuer  string
+	MFATokenTTL time.Duration
+
+	// Protección contra fuerza bruta en el inicio de sesión: fallos permitidos
+	// por usuario y por IP dentro de LoginFailureWindow antes de bloquear, y
+	// duración del primer bloqueo (se duplica en cada fallo adicional hasta LoginLockoutMax)
+	LoginMaxFailures      int
+	LoginMaxFailuresPerIP int
+	LoginFailureWindow    time.Duration
+	LoginLockoutBase      time.Duration
+	LoginLockoutMax       time.Duration
+
+	// Credenciales de los servicios que pueden usar la introspección de tokens
+	// (INTROSPECTION_CLIENTS="servicio1:secreto1,servicio2:secreto2")
+	IntrospectionClients map[string]string
+
+	// Eliminación de cuentas: tiempo durante el que el usuario puede cancelarla
+	// iniciando sesión, y cada cuánto se eliminan las cuentas vencidas
+	AccountDeletionGrace time.Duration
+	AccountPurgeInterval time.Duration
+
+	// Registro de auditoría: antigüedad máxima de los eventos y cada cuánto se depuran
+	AuditRetention     time.Duration
+	AuditPruneInterval time.Duration
+
+	// Vigencia de los códigos de autorización del proveedor OpenID Connect.
+	// El emisor (iss de los id_token) es AppBaseURL.
+	AuthorizationCodeTTL time.Duration
+
+	// Clave con la que se firman los tokens CSRF de la página de autorización.
+	// Si está vacía, cada instancia genera una clave aleatoria al iniciar.
+	OIDCCSRFSecret string
 }
 
 // LoadConfig carga la configuración desde variables de entorno
@@ -26,6 +144,8 @@ func LoadConfig() (config Config, err error) {
 		return config, fmt.Errorf("error cargando archivo .env: %w", err)
 	}
 
+	config.DBDriver = getEnv("DB_DRIVER", "mysql")
+	config.SQLitePath = getEnv("SQLITE_PATH", "auth.db")
 	config.DBUser = os.Getenv("DB_USER")
 	config.DBPass = os.Getenv("DB_PASS")
 	config.DBHost = os.Getenv("DB_HOST")
@@ -33,11 +153,269 @@ func LoadConfig() (config Config, err error) {
 	config.DBName = os.Getenv("DB_NAME")
 	config.APIPort = os.Getenv("API_PORT")
 	config.JWTSecret = os.Getenv("JWT_SECRET")
+	config.JWTAlgorithm = getEnv("JWT_ALG", "HS256")
+	config.JWTKeysDir = getEnv("JWT_KEYS_DIR", "keys")
+	config.JWTActiveKID = os.Getenv("JWT_ACTIVE_KID")
+	config.AppBaseURL = getEnv("APP_BASE_URL", "http://localhost:"+config.APIPort)
+	config.MailDriver = getEnv("MAIL_DRIVER", "outbox")
+	config.MailFrom = getEnv("MAIL_FROM", "no-reply@auth-service.local")
+	config.MailOutboxDir = getEnv("MAIL_OUTBOX_DIR", "outbox")
+	config.SMTPHost = os.Getenv("SMTP_HOST")
+	config.SMTPPort = getEnv("SMTP_PORT", "587")
+	config.SMTPUser = os.Getenv("SMTP_USER")
+	config.SMTPPass = os.Getenv("SMTP_PASS")
+	config.TOTPIssuer = getEnv("TOTP_ISSUER", "auth-service")
+	config.OIDCCSRFSecret = os.Getenv("OIDC_CSRF_SECRET")
+	config.BootstrapInvitationFile = getEnv("BOOTSTRAP_INVITATION_FILE", "bootstrap_invitation.txt")
+
+	if config.AutoMigrate, err = getBool("DB_AUTO_MIGRATE", true); err != nil {
+		return config, err
+	}
+
+	if config.AccessTokenTTL, err = getDuration("ACCESS_TOKEN_TTL", 15*time.Minute); err != nil {
+		return config, err
+	}
+	if config.RefreshTokenTTL, err = getDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour); err != nil {
+		return config, err
+	}
+
+	if config.RevocationSyncInterval, err = getDuration("REVOCATION_SYNC_INTERVAL", 30*time.Second); err != nil {
+		return config, err
+	}
+
+	if config.InvitationTTL, err = getDuration("INVITATION_TTL", 72*time.Hour); err != nil {
+		return config, err
+	}
+
+	if config.PasswordResetTTL, err = getDuration("PASSWORD_RESET_TTL", time.Hour); err != nil {
+		return config, err
+	}
+	if config.MagicLinkTTL, err = getDuration("MAGIC_LINK_TTL", 15*time.Minute); err != nil {
+		return config, err
+	}
+
+	if config.EmailVerificationTTL, err = getDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour); err != nil {
+		return config, err
+	}
+	if config.RequireEmailVerification, err = getBool("REQUIRE_EMAIL_VERIFICATION", false); err != nil {
+		return config, err
+	}
+	if config.EmailChangeTTL, err = getDuration("EMAIL_CHANGE_TTL", 24*time.Hour); err != nil {
+		return config, err
+	}
+	if config.EmailChangeUndoTTL, err = getDuration("EMAIL_CHANGE_UNDO_TTL", 7*24*time.Hour); err != nil {
+		return config, err
+	}
+
+	config.PasswordHashAlgorithm = getEnv("PASSWORD_HASH_ALGORITHM", "argon2id")
+	if config.Argon2Memory, err = getInt("ARGON2_MEMORY", 64*1024); err != nil {
+		return config, err
+	}
+	if config.Argon2Iterations, err = getInt("ARGON2_ITERATIONS", 3); err != nil {
+		return config, err
+	}
+	if config.Argon2Parallelism, err = getInt("ARGON2_PARALLELISM", 2); err != nil {
+		return config, err
+	}
+	if config.BcryptCost, err = getInt("BCRYPT_COST", 10); err != nil {
+		return config, err
+	}
+
+	if config.PasswordMinLength, err = getInt("PASSWORD_MIN_LENGTH", 8); err != nil {
+		return config, err
+	}
+	if config.PasswordMaxLength, err = getInt("PASSWORD_MAX_LENGTH", 128); err != nil {
+		return config, err
+	}
+	if config.PasswordRequireUppercase, err = getBool("PASSWORD_REQUIRE_UPPERCASE", false); err != nil {
+		return config, err
+	}
+	if config.PasswordRequireLowercase, err = getBool("PASSWORD_REQUIRE_LOWERCASE", false); err != nil {
+		return config, err
+	}
+	if config.PasswordRequireDigit, err = getBool("PASSWORD_REQUIRE_DIGIT", false); err != nil {
+		return config, err
+	}
+	if config.PasswordRequireSymbol, err = getBool("PASSWORD_REQUIRE_SYMBOL", false); err != nil {
+		return config, err
+	}
+	if config.PasswordDisallowUserInfo, err = getBool("PASSWORD_DISALLOW_USER_INFO", true); err != nil {
+		return config, err
+	}
+	if config.PasswordHistory, err = getNonNegativeInt("PASSWORD_HISTORY", 5); err != nil {
+		return config, err
+	}
+	config.BreachedPasswordsFile = getEnv("BREACHED_PASSWORDS_FILE", "")
+
+	if config.MFATokenTTL, err = getDuration("MFA_TOKEN_TTL", 5*time.Minute); err != nil {
+		return config, err
+	}
+
+	if config.LoginMaxFailures, err = getInt("LOGIN_MAX_FAILURES", 5); err != nil {
+		return config, err
+	}
+	if config.LoginMaxFailuresPerIP, err = getInt("LOGIN_MAX_FAILURES_PER_IP", 20); err != nil {
+		return config, err
+	}
+	if config.LoginFailureWindow, err = getDuration("LOGIN_FAILURE_WINDOW", 24*time.Hour); err != nil {
+		return config, err
+	}
+	if config.LoginLockoutBase, err = getDuration("LOGIN_LOCKOUT_BASE", 30*time.Second); err != nil {
+		return config, err
+	}
+	if config.LoginLockoutMax, err = getDuration("LOGIN_LOCKOUT_MAX", time.Hour); err != nil {
+		return config, err
+	}
+
+	if config.IntrospectionClients, err = getCredentials("INTROSPECTION_CLIENTS"); err != nil {
+		return config, err
+	}
+
+	if config.AuthorizationCodeTTL, err = getDuration("AUTHORIZATION_CODE_TTL", time.Minute); err != nil {
+		return config, err
+	}
+
+	if config.AccountDeletionGrace, err = getDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour); err != nil {
+		return config, err
+	}
+	if config.AccountPurgeInterval, err = getDuration("ACCOUNT_PURGE_INTERVAL", time.Hour); err != nil {
+		return config, err
+	}
+
+	if config.AuditRetention, err = getDuration("AUDIT_RETENTION", 90*24*time.Hour); err != nil {
+		return config, err
+	}
+	if config.AuditPruneInterval, err = getDuration("AUDIT_PRUNE_INTERVAL", time.Hour); err != nil {
+		return config, err
+	}
 
 	// Validar configuración mínima
-	if config.DBUser == "" || config.DBHost == "" || config.DBName == "" || config.JWTSecret == "" {
-		return config, fmt.Errorf("faltan variables de entorno obligatorias")
+	switch config.DBDriver {
+	case "mysql":
+		if config.DBUser == "" || config.DBHost == "" || config.DBName == "" {
+			return config, fmt.Errorf("faltan variables de entorno obligatorias")
+		}
+	case "sqlite", "memory":
+	default:
+		return config, fmt.Errorf("DB_DRIVER no soportado: %q", config.DBDriver)
+	}
+
+	switch config.PasswordHashAlgorithm {
+	case "argon2id":
+		if config.Argon2Memory < 8*config.Argon2Parallelism || config.Argon2Iterations < 1 ||
+			config.Argon2Parallelism < 1 || config.Argon2Parallelism > 255 {
+			return config, fmt.Errorf("parámetros de argon2id inválidos")
+		}
+	case "bcrypt":
+		if config.BcryptCost < 4 || config.BcryptCost > 31 {
+			return config, fmt.Errorf("BCRYPT_COST debe estar entre 4 y 31")
+		}
+	default:
+		return config, fmt.Errorf("PASSWORD_HASH_ALGORITHM no soportado: %q", config.PasswordHashAlgorithm)
+	}
+
+	if config.PasswordMinLength < 1 || (config.PasswordMaxLength > 0 && config.PasswordMaxLength < config.PasswordMinLength) {
+		return config, fmt.Errorf("PASSWORD_MIN_LENGTH y PASSWORD_MAX_LENGTH inválidos")
+	}
+
+	// JWT_SECRET solo es necesario con firma simétrica
+	switch config.JWTAlgorithm {
+	case "HS256":
+		if config.JWTSecret == "" {
+			return config, fmt.Errorf("JWT_SECRET es obligatorio con JWT_ALG=HS256")
+		}
+	case "RS256", "EdDSA":
+	default:
+		return config, fmt.Errorf("JWT_ALG no soportado: %q", config.JWTAlgorithm)
 	}
 
 	return config, nil
 }
+
+// getEnv lee una variable de entorno o devuelve el valor por defecto
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getCredentials lee una lista de pares "id:secreto" separados por comas
+func getCredentials(key string) (map[string]string, error) {
+	credentials := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("valor inválido para %s: se espera id:secreto", key)
+		}
+		credentials[id] = secret
+	}
+
+	return credentials, nil
+}
+
+// getInt lee un entero positivo o devuelve el valor por defecto
+func getInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("valor inválido para %s: %q", key, value)
+	}
+
+	return parsed, nil
+}
+
+// getNonNegativeInt lee un entero mayor o igual que cero o devuelve el valor
+// por defecto, para variables en las que 0 desactiva la función
+func getNonNegativeInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("valor inválido para %s: %q", key, value)
+	}
+
+	return parsed, nil
+}
+
+// getBool lee un valor booleano ("true", "false", "1", "0"...) o devuelve el valor por defecto
+func getBool(key string, defaultValue bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("valor inválido para %s: %q", key, value)
+	}
+
+	return parsed, nil
+}
+
+// getDuration lee una duración (por ejemplo "15m" o "168h") o devuelve el valor por defecto
+func getDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("valor inválido para %s: %q", key, value)
+	}
+
+	return duration, nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetNonNegativeInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"sin definir usa el valor por defecto", "", 5, false},
+		{"cero desactiva", "0", 0, false},
+		{"positivo", "12", 12, false},
+		{"negativo", "-1", 0, true},
+		{"no numérico", "cinco", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_NON_NEGATIVE", tt.value)
+			got, err := getNonNegativeInt("TEST_NON_NEGATIVE", 5)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getNonNegativeInt = %d, se esperaba %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPasswordHistory(t *testing.T) {
+	// LoadConfig exige un archivo .env en el directorio actual
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	t.Setenv("DB_DRIVER", "memory")
+	t.Setenv("JWT_SECRET", "secreto-de-pruebas")
+
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 5, false},
+		{"0", 0, false},
+		{"3", 3, false},
+		{"-2", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run("PASSWORD_HISTORY="+tt.value, func(t *testing.T) {
+			t.Setenv("PASSWORD_HISTORY", tt.value)
+			cfg, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v", err)
+			}
+			if err == nil && cfg.PasswordHistory != tt.want {
+				t.Errorf("PasswordHistory = %d, se esperaba %d", cfg.PasswordHistory, tt.want)
+			}
+		})
+	}
+}
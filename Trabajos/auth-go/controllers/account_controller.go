@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"auth/models"
+	"auth/store"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateProfile cambia el nombre de usuario del usuario autenticado. El
+// correo se cambia con RequestEmailChange.
+func (ac *AuthController) UpdateProfile(c *gin.Context) {
+	var req models.UpdateProfileRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos del perfil inválidos"})
+		return
+	}
+	username := models.NormalizeUsername(req.Username)
+	if !checkUsername(c, username) {
+		return
+	}
+
+	user, ok := ac.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if username == user.Username {
+		c.JSON(http.StatusOK, userResponse(user))
+		return
+	}
+
+	// El almacén rechaza nombres en uso por otro usuario
+	if err := ac.Users.UpdateUsername(user.ID, username); err != nil {
+		if err == store.ErrUserExists {
+			c.JSON(http.StatusConflict, models.ResponseError{Error: "El nombre de usuario ya está en uso"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al actualizar el perfil"})
+		}
+		return
+	}
+
+	audit(c, models.AuditEvent{
+		EventType: models.AuditProfileUpdated,
+		Outcome:   models.AuditSuccess,
+		TargetID:  user.ID,
+		Details:   "usuario: " + user.Username + " -> " + username,
+	})
+
+	user.Username = username
+	c.JSON(http.StatusOK, userResponse(user))
+}
+
+// ChangePassword cambia la contraseña del usuario autenticado, que debe
+// indicar la actual, y cierra sus demás sesiones
+func (ac *AuthController) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos del cambio de contraseña inválidos"})
+		return
+	}
+
+	if c.GetInt("api_key_id") != 0 {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "No se puede cambiar la contraseña autenticándose con una clave de API"})
+		return
+	}
+
+	user, ok := ac.loadCurrentUser(c)
+	if !ok || !ac.checkCurrentPassword(c, user, req.CurrentPassword, models.AuditPasswordChanged) {
+		return
+	}
+
+	// Validar la nueva contraseña con la política (incluido el historial)
+	if !ac.checkPasswordPolicy(c, user, req.NewPassword) {
+		return
+	}
+
+	hashedPassword, err := ac.Passwords.Hash(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al procesar la contraseña"})
+		return
+	}
+	if err := ac.Users.UpdatePassword(user.ID, hashedPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al cambiar la contraseña"})
+		return
+	}
+	ac.recordPasswordHistory(user.ID, hashedPassword)
+
+	// Cerrar las demás sesiones, que pudieron abrirse con la contraseña anterior
+	if err := revokeUserSessions(user.ID, c.GetString("session_id"), ac.Config.AccessTokenTTL); err != nil {
+		log.Printf("Error al cerrar las sesiones del usuario %d: %v", user.ID, err)
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditPasswordChanged, Outcome: models.AuditSuccess, TargetID: user.ID})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Contraseña cambiada correctamente"})
+}
+
+// DeleteAccount programa la eliminación de la cuenta del usuario autenticado.
+// La cuenta deja de poder usarse de inmediato y se elimina definitivamente
+// tras ACCOUNT_DELETION_GRACE; si antes vuelve a iniciar sesión, la eliminación se cancela.
+func (ac *AuthController) DeleteAccount(c *gin.Context) {
+	var req models.DeleteAccountRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos de eliminación de la cuenta inválidos"})
+		return
+	}
+
+	if c.GetInt("api_key_id") != 0 {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "No se puede eliminar la cuenta autenticándose con una clave de API"})
+		return
+	}
+
+	user, ok := ac.loadCurrentUser(c)
+	if !ok || !ac.checkCurrentPassword(c, user, req.Password, models.AuditAccountDeletionRequested) {
+		return
+	}
+
+	deleteAfter := time.Now().Add(ac.Config.AccountDeletionGrace).UTC().Truncate(time.Second)
+	if err := ac.Users.ScheduleDeletion(user.ID, deleteAfter); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al eliminar la cuenta"})
+		return
+	}
+
+	// Cerrar todas las sesiones, incluida la actual
+	if err := revokeUserSessions(user.ID, "", ac.Config.AccessTokenTTL); err != nil {
+		log.Printf("Error al cerrar las sesiones del usuario %d: %v", user.ID, err)
+	}
+
+	audit(c, models.AuditEvent{
+		EventType: models.AuditAccountDeletionRequested,
+		Outcome:   models.AuditSuccess,
+		TargetID:  user.ID,
+		Details:   "eliminación a partir de " + deleteAfter.Format(time.RFC3339),
+	})
+	c.JSON(http.StatusOK, models.AccountDeletionResponse{
+		Message:     "La cuenta se eliminará definitivamente en la fecha indicada. Inicia sesión antes para cancelarlo",
+		DeleteAfter: deleteAfter,
+	})
+}
+
+// loadCurrentUser carga el usuario autenticado, respondiendo con el error si no existe
+func (ac *AuthController) loadCurrentUser(c *gin.Context) (models.User, bool) {
+	user, err := ac.Users.FindByID(c.GetInt("user_id"))
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, models.ResponseError{Error: "Usuario no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		}
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// checkCurrentPassword confirma la contraseña actual antes de una operación
+// sensible. Los fallos cuentan para el bloqueo por intentos fallidos, de modo
+// que un token robado no permita adivinar la contraseña.
+func (ac *AuthController) checkCurrentPassword(c *gin.Context, user models.User, password, eventType string) bool {
+	if !ac.checkLoginLock(c, user.Username) {
+		return false
+	}
+
+	match, _, err := ac.Passwords.Verify(password, user.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar la contraseña"})
+		return false
+	}
+	if !match {
+		ac.recordLoginFailure(c, user.Username)
+		audit(c, models.AuditEvent{EventType: eventType, Outcome: models.AuditFailure, TargetID: user.ID, Details: "contraseña incorrecta"})
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "La contraseña actual es incorrecta"})
+		return false
+	}
+	return true
+}
+
+// cancelAccountDeletion cancela la eliminación programada de la cuenta al
+// iniciar sesión durante el periodo de gracia
+func (ac *AuthController) cancelAccountDeletion(c *gin.Context, user *models.User) error {
+	if user.DeleteAfter == nil {
+		return nil
+	}
+	if err := ac.Users.CancelDeletion(user.ID); err != nil {
+		return err
+	}
+	user.DeleteAfter = nil
+
+	audit(c, models.AuditEvent{EventType: models.AuditAccountDeletionCancelled, Outcome: models.AuditSuccess, ActorID: user.ID, ActorName: user.Username, TargetID: user.ID})
+	return nil
+}
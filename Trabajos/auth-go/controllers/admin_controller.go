@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"auth/config"
+	"auth/db"
+	"auth/models"
+	"auth/store"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminController maneja la administración de usuarios
+type AdminController struct {
+	Config config.Config
+	Users  store.UserStore
+}
+
+// NewAdminController crea una nueva instancia del controlador de administración
+func NewAdminController(config config.Config, users store.UserStore) *AdminController {
+	return &AdminController{Config: config, Users: users}
+}
+
+// Límites de la paginación del listado de usuarios
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ListUsers lista los usuarios de forma paginada.
+// Filtros opcionales: role, email (coincidencia parcial), created_from y created_to.
+func (adc *AdminController) ListUsers(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	// Construir los filtros de la consulta
+	filter := store.UserFilter{
+		Role:  c.Query("role"),
+		Email: c.Query("email"),
+	}
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{"created_from", &filter.CreatedFrom},
+		{"created_to", &filter.CreatedTo},
+	} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		date, err := parseDateParam(value, param.name == "created_to")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Fecha inválida en " + param.name})
+			return
+		}
+		*param.value = date
+	}
+
+	users, total, err := adc.Users.List(filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al listar los usuarios"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserListResponse{
+		Users:    users,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	})
+}
+
+// GetUser obtiene un usuario por su ID
+func (adc *AdminController) GetUser(c *gin.Context) {
+	user, ok := adc.loadUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateRole cambia el rol de un usuario
+func (adc *AdminController) UpdateRole(c *gin.Context) {
+	var req models.UpdateRoleRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Rol inválido"})
+		return
+	}
+
+	user, ok := adc.loadOtherUser(c)
+	if !ok || !checkGrantableRole(c, req.Role) {
+		return
+	}
+
+	if err := adc.Users.UpdateRole(user.ID, req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al actualizar el rol"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditRoleChanged, Outcome: models.AuditSuccess, TargetID: user.ID, Details: user.Role + " -> " + req.Role})
+	user.Role = req.Role
+	c.JSON(http.StatusOK, user)
+}
+
+// DisableUser deshabilita una cuenta y revoca sus tokens de renovación
+func (adc *AdminController) DisableUser(c *gin.Context) {
+	adc.setDisabled(c, true)
+}
+
+// EnableUser vuelve a habilitar una cuenta deshabilitada
+func (adc *AdminController) EnableUser(c *gin.Context) {
+	adc.setDisabled(c, false)
+}
+
+// setDisabled cambia el estado de habilitación de una cuenta
+func (adc *AdminController) setDisabled(c *gin.Context, disabled bool) {
+	user, ok := adc.loadOtherUser(c)
+	if !ok {
+		return
+	}
+
+	if err := adc.Users.SetDisabled(user.ID, disabled); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al actualizar la cuenta"})
+		return
+	}
+
+	// Los tokens de acceso ya emitidos son rechazados por AuthMiddleware
+	if disabled {
+		if err := revokeUserSessions(user.ID, "", adc.Config.AccessTokenTTL); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al revocar los tokens de renovación"})
+			return
+		}
+	}
+
+	eventType := models.AuditUserEnabled
+	if disabled {
+		eventType = models.AuditUserDisabled
+	}
+	audit(c, models.AuditEvent{EventType: eventType, Outcome: models.AuditSuccess, TargetID: user.ID})
+
+	user.Disabled = disabled
+	c.JSON(http.StatusOK, user)
+}
+
+// ForcePasswordReset obliga al usuario a restablecer su contraseña y cierra sus sesiones
+func (adc *AdminController) ForcePasswordReset(c *gin.Context) {
+	user, ok := adc.loadOtherUser(c)
+	if !ok {
+		return
+	}
+
+	if err := adc.Users.SetMustResetPassword(user.ID, true); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al actualizar la cuenta"})
+		return
+	}
+	if err := revokeUserSessions(user.ID, "", adc.Config.AccessTokenTTL); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al revocar los tokens de renovación"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditForcePasswordReset, Outcome: models.AuditSuccess, TargetID: user.ID})
+	user.MustResetPassword = true
+	c.JSON(http.StatusOK, user)
+}
+
+// UnlockUser elimina el bloqueo por intentos fallidos de inicio de sesión de una cuenta
+func (adc *AdminController) UnlockUser(c *gin.Context) {
+	user, ok := adc.loadUser(c)
+	if !ok {
+		return
+	}
+
+	if err := db.ClearLoginFailures(db.LoginScopeUser, strings.ToLower(user.Username)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al desbloquear la cuenta"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditUserUnlocked, Outcome: models.AuditSuccess, TargetID: user.ID})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Cuenta desbloqueada correctamente"})
+}
+
+// DeleteUser elimina una cuenta de forma permanente
+func (adc *AdminController) DeleteUser(c *gin.Context) {
+	user, ok := adc.loadOtherUser(c)
+	if !ok {
+		return
+	}
+
+	// Los tokens de renovación se eliminan en cascada
+	if err := adc.Users.Delete(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al eliminar el usuario"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditUserDeleted, Outcome: models.AuditSuccess, TargetID: user.ID, Details: user.Username})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Usuario eliminado correctamente"})
+}
+
+// loadUser carga el usuario indicado en la ruta, respondiendo con error si no existe
+func (adc *AdminController) loadUser(c *gin.Context) (models.User, bool) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return models.User{}, false
+	}
+
+	user, err := adc.Users.FindByID(id)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, models.ResponseError{Error: "Usuario no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		}
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// loadOtherUser es como loadUser, pero impide que un administrador se aplique
+// la acción a sí mismo (y pierda así el acceso de administración) o la aplique
+// a un usuario cuyo rol tiene permisos que él no tiene
+func (adc *AdminController) loadOtherUser(c *gin.Context) (models.User, bool) {
+	user, ok := adc.loadUser(c)
+	if !ok {
+		return models.User{}, false
+	}
+
+	if user.ID == c.GetInt("user_id") {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "No puedes aplicar esta acción a tu propia cuenta"})
+		return models.User{}, false
+	}
+	if !checkGrantableRole(c, user.Role) {
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// parsePagination lee los parámetros page y page_size. La página se limita
+// para que el desplazamiento (page-1)*page_size no desborde
+func parsePagination(c *gin.Context) (page int, pageSize int, ok bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 || page > math.MaxInt/maxPageSize {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Página inválida"})
+		return 0, 0, false
+	}
+
+	pageSize, err = strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Tamaño de página inválido"})
+		return 0, 0, false
+	}
+
+	return page, pageSize, true
+}
+
+// parseDateParam acepta fechas RFC 3339 o YYYY-MM-DD. Con endOfDay, una fecha
+// sin hora incluye el día completo.
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+	maxPage := strconv.Itoa(math.MaxInt / maxPageSize)
+
+	tests := []struct {
+		name         string
+		query        string
+		wantPage     int
+		wantPageSize int
+		wantOK       bool
+	}{
+		{"valores por defecto", "", 1, defaultPageSize, true},
+		{"página y tamaño", "?page=3&page_size=50", 3, 50, true},
+		{"tamaño máximo", "?page_size=100", 1, maxPageSize, true},
+		{"última página permitida", "?page=" + maxPage + "&page_size=100", math.MaxInt / maxPageSize, maxPageSize, true},
+		{"página que desborda el desplazamiento", "?page=100000000000000000&page_size=100", 0, 0, false},
+		{"página fuera del rango de int", "?page=99999999999999999999", 0, 0, false},
+		{"página cero", "?page=0", 0, 0, false},
+		{"página negativa", "?page=-1", 0, 0, false},
+		{"página no numérica", "?page=uno", 0, 0, false},
+		{"tamaño cero", "?page_size=0", 0, 0, false},
+		{"tamaño mayor que el máximo", "?page_size=101", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newTestContext(http.MethodGet, "/api/auth/admin/users"+tt.query, "192.0.2.1")
+			page, pageSize, ok := parsePagination(c)
+			if page != tt.wantPage || pageSize != tt.wantPageSize || ok != tt.wantOK {
+				t.Errorf("parsePagination = %d, %d, %v; se esperaba %d, %d, %v", page, pageSize, ok, tt.wantPage, tt.wantPageSize, tt.wantOK)
+			}
+			if !ok && rec.Code != http.StatusBadRequest {
+				t.Errorf("código %d, se esperaba %d", rec.Code, http.StatusBadRequest)
+			}
+			if ok && (page-1)*pageSize < 0 {
+				t.Errorf("desplazamiento negativo: %d", (page-1)*pageSize)
+			}
+		})
+	}
+}
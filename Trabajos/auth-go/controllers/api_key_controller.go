@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/models"
+	"auth/security"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Prefijo de las claves de API y cantidad de caracteres visibles tras él
+const (
+	apiKeyPrefix        = "ak_"
+	apiKeyVisibleLength = 8
+)
+
+// CreateAPIKey crea una clave de API para el usuario autenticado. La clave
+// solo se devuelve en esta respuesta; en la base de datos se guarda su hash.
+func (ac *AuthController) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos de la clave de API inválidos"})
+		return
+	}
+
+	// Una clave no puede crear otras claves, para que su filtración no permita mantener el acceso
+	if c.GetInt("api_key_id") != 0 {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "No se puede crear una clave de API autenticándose con otra clave"})
+		return
+	}
+
+	// La clave tiene como mucho los permisos del usuario
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+	if !checkGrantableRole(c, req.Role) {
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if req.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+
+	secret, err := security.NewOpaqueToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar la clave de API"})
+		return
+	}
+	key := apiKeyPrefix + secret
+	prefix := key[:len(apiKeyPrefix)+apiKeyVisibleLength]
+
+	userID := c.GetInt("user_id")
+	id, err := db.CreateAPIKey(userID, req.Name, prefix, security.HashToken(key), req.Role, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al crear la clave de API"})
+		return
+	}
+
+	stored, err := db.FindAPIKey(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar la clave de API"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditAPIKeyCreated, Outcome: models.AuditSuccess, TargetID: userID, Details: prefix + " (rol: " + req.Role + ")"})
+	c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{
+		Key:    key,
+		APIKey: apiKeyResponse(*stored, time.Now()),
+	})
+}
+
+// ListAPIKeys lista las claves de API del usuario autenticado con su estado
+func (ac *AuthController) ListAPIKeys(c *gin.Context) {
+	keys, err := db.ListAPIKeys(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al listar las claves de API"})
+		return
+	}
+
+	now := time.Now()
+	response := make([]models.APIKeyResponse, len(keys))
+	for i, key := range keys {
+		response[i] = apiKeyResponse(key, now)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeAPIKey revoca una clave de API del usuario autenticado
+func (ac *AuthController) RevokeAPIKey(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := db.RevokeAPIKey(id, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al revocar la clave de API"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, models.ResponseError{Error: "Clave de API no encontrada o ya revocada"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditAPIKeyRevoked, Outcome: models.AuditSuccess, TargetID: c.GetInt("user_id"), Details: "id: " + strconv.Itoa(id)})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Clave de API revocada correctamente"})
+}
+
+// apiKeyResponse agrega las fechas opcionales y el estado de la clave
+func apiKeyResponse(key models.APIKey, now time.Time) models.APIKeyResponse {
+	response := models.APIKeyResponse{APIKey: key, Status: "active"}
+	if key.ExpiresAt.Valid {
+		response.ExpiresAt = &key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		response.LastUsedAt = &key.LastUsedAt.Time
+	}
+
+	switch {
+	case key.RevokedAt.Valid:
+		response.Status = "revoked"
+	case !key.IsActive(now):
+		response.Status = "expired"
+	}
+
+	return response
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Longitud máxima de los textos libres de un evento de auditoría
+const maxAuditDetailsLength = 500
+
+// audit agrega un evento al registro de auditoría con la IP y el user agent de
+// la solicitud. Si no se indica actor se usa el usuario autenticado. Un fallo
+// al registrar el evento no interrumpe la solicitud.
+func audit(c *gin.Context, event models.AuditEvent) {
+	if event.ActorID == 0 {
+		event.ActorID = c.GetInt("user_id")
+	}
+	if event.ActorName == "" {
+		event.ActorName = c.GetString("username")
+	}
+	event.ActorName = truncate(event.ActorName, maxUserAgentLength)
+	event.Details = truncate(event.Details, maxAuditDetailsLength)
+	event.IP = c.ClientIP()
+	event.UserAgent = truncate(c.Request.UserAgent(), maxUserAgentLength)
+	event.CreatedAt = time.Now()
+
+	if err := db.InsertAuditEvent(event); err != nil {
+		log.Printf("Error al registrar el evento de auditoría %s: %v", event.EventType, err)
+	}
+}
+
+// truncate recorta el texto a max bytes sin cortar un carácter UTF-8
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	for max > 0 && !utf8.RuneStart(value[max]) {
+		max--
+	}
+	return value[:max]
+}
+
+// ListAuditEvents lista los eventos de auditoría de forma paginada, del más
+// reciente al más antiguo. Filtros opcionales: event_type, outcome, actor_id,
+// target_id, ip, from y to (RFC 3339 o YYYY-MM-DD).
+func (adc *AdminController) ListAuditEvents(c *gin.Context) {
+	page, pageSize, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	filter := models.AuditFilter{
+		EventType: c.Query("event_type"),
+		Outcome:   c.Query("outcome"),
+		IP:        c.Query("ip"),
+	}
+	for param, target := range map[string]*int{"actor_id": &filter.ActorID, "target_id": &filter.TargetID} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "ID inválido en " + param})
+			return
+		}
+		*target = id
+	}
+	for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		date, err := parseDateParam(value, param == "to")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Fecha inválida en " + param})
+			return
+		}
+		*target = date
+	}
+
+	events, total, err := db.ListAuditEvents(filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al listar los eventos de auditoría"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AuditEventListResponse{
+		Events:   events,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	})
+}
@@ -3,24 +3,45 @@ package controllers
 import (
 	"auth/config"
 	"auth/db"
+	"auth/mailer"
 	"auth/middleware"
 	"auth/models"
+	"auth/security"
+	"auth/store"
 	"database/sql"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // AuthController maneja las solicitudes relacionadas con la autenticación
 type AuthController struct {
-	Config config.Config
+	Config    config.Config
+	Mailer    mailer.Mailer
+	Users     store.UserStore
+	Passwords security.PasswordHasher
+	Policy    security.PasswordPolicy
 }
 
 // NewAuthController crea una nueva instancia del controlador de autenticación
-func NewAuthController(config config.Config) *AuthController {
-	return &AuthController{Config: config}
+func NewAuthController(config config.Config, mailer mailer.Mailer, users store.UserStore, policy security.PasswordPolicy) *AuthController {
+	return &AuthController{
+		Config: config,
+		Mailer: mailer,
+		Users:  users,
+		Passwords: security.PasswordHasher{
+			Algorithm:         config.PasswordHashAlgorithm,
+			Argon2Memory:      uint32(config.Argon2Memory),
+			Argon2Iterations:  uint32(config.Argon2Iterations),
+			Argon2Parallelism: uint8(config.Argon2Parallelism),
+			BcryptCost:        config.BcryptCost,
+		},
+		Policy: policy,
+	}
 }
 
 // Register registra un nuevo usuario
@@ -33,66 +54,113 @@ func (ac *AuthController) Register(c *gin.Context) {
 		return
 	}
 
-	// Verificar si el usuario ya existe
-	var exists int
-	err := db.Database.QueryRow("SELECT COUNT(*) FROM users WHERE username = ? OR email = ?", req.Username, req.Email).Scan(&exists)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el usuario"})
+	// Normalizar como lo hace el almacén, para validar la contraseña y la
+	// invitación con los valores que se guardan
+	req.Username = models.NormalizeUsername(req.Username)
+	req.Email = models.NormalizeEmail(req.Email)
+	if !checkUsername(c, req.Username) {
+		return
+	}
+	if !validEmail(req.Email) {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Correo electrónico inválido"})
 		return
 	}
 
-	if exists > 0 {
-		c.JSON(http.StatusConflict, models.ResponseError{Error: "El nombre de usuario o correo electrónico ya está en uso"})
+	// Validar la contraseña con la política configurada
+	if !ac.checkPasswordPolicy(c, models.User{Username: req.Username, Email: req.Email}, req.Password) {
 		return
 	}
 
 	// Encriptar la contraseña
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := ac.Passwords.Hash(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al procesar la contraseña"})
 		return
 	}
-	// Determinar el rol del usuario
-	role := "user" // Rol por defecto
-	if req.Role == "admin" || req.Role == "user" {
-		role = req.Role
+	// Los registros sin invitación siempre obtienen el rol por defecto
+	role := models.RoleUser
+	var invitation *models.Invitation
+	if req.InviteCode != "" {
+		invitation, err = db.FindInvitationByCode(security.HashToken(req.InviteCode))
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar la invitación"})
+			return
+		}
+		if err == sql.ErrNoRows || !invitation.IsUsable(time.Now()) ||
+			(invitation.Email != "" && !strings.EqualFold(invitation.Email, req.Email)) {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Código de invitación inválido o expirado"})
+			return
+		}
+		role = invitation.Role
 	}
 
-	// Insertar el nuevo usuario en la base de datos
-	result, err := db.Database.Exec(
-		"INSERT INTO users (username, email, password, role) VALUES (?, ?, ?, ?)",
-		req.Username,
-		req.Email,
-		hashedPassword,
-		role,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al crear el usuario"})
+	// Guardar el nuevo usuario; el almacén rechaza nombres o correos repetidos
+	user := models.User{
+		Username: req.Username,
+		Email:    req.Email,
+		Password: hashedPassword,
+		Role:     role,
+	}
+	if err := ac.Users.Create(&user); err != nil {
+		if err == store.ErrUserExists {
+			c.JSON(http.StatusConflict, models.ResponseError{Error: "El nombre de usuario o correo electrónico ya está en uso"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al crear el usuario"})
+		}
 		return
 	}
 
-	// Obtener el ID del usuario insertado
-	userID, err := result.LastInsertId()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al obtener el ID del usuario"})
+	// Consumir la invitación; si otra solicitud se adelantó, deshacer el registro
+	if invitation != nil {
+		claimed, err := db.ClaimInvitation(invitation.ID, user.ID)
+		if err != nil || !claimed {
+			if err := ac.Users.Delete(user.ID); err != nil {
+				log.Printf("Error al deshacer el registro del usuario %d: %v", user.ID, err)
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al usar la invitación"})
+			} else {
+				c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Código de invitación inválido o expirado"})
+			}
+			return
+		}
+	}
+
+	ac.recordPasswordHistory(user.ID, user.Password)
+
+	audit(c, models.AuditEvent{
+		EventType: models.AuditRegister,
+		Outcome:   models.AuditSuccess,
+		ActorID:   user.ID,
+		ActorName: user.Username,
+		TargetID:  user.ID,
+		Details:   "rol: " + role,
+	})
+
+	// Enviar el correo de verificación; un fallo no impide el registro,
+	// el usuario puede pedir que se reenvíe
+	if err := ac.sendEmailVerification(user); err != nil {
+		log.Printf("Error al enviar el correo de verificación al usuario %d: %v", user.ID, err)
+	}
+
+	// Si se exige verificar el correo, no se emiten tokens hasta entonces
+	if ac.Config.RequireEmailVerification {
+		c.JSON(http.StatusCreated, models.PendingVerificationResponse{
+			Message: "Usuario registrado. Revisa tu correo electrónico para verificar tu cuenta",
+			User:    userResponse(user),
+		})
 		return
-	}	// Generar un token JWT para el nuevo usuario
-	token, expiresAt, err := middleware.GenerateToken(int(userID), req.Username, req.Email, role, ac.Config.JWTSecret)
+	}
+
+	// Generar los tokens para el nuevo usuario
+	response, err := ac.issueTokens(c, user, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el token"})
 		return
 	}
-	// Devolver la respuesta con el token
-	c.JSON(http.StatusCreated, models.TokenResponse{
-		Token:     token,
-		ExpiresAt: expiresAt.Format(time.RFC3339),
-		User: models.UserResponse{
-			ID:       int(userID),
-			Username: req.Username,
-			Email:    req.Email,
-			Role:     role,
-		},
-	})
+
+	// Devolver la respuesta con los tokens
+	c.JSON(http.StatusCreated, response)
 }
 
 // Login inicia sesión con un usuario existente
@@ -104,48 +172,316 @@ func (ac *AuthController) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos de inicio de sesión inválidos"})
 		return
 	}
+	identifier := req.LoginIdentifier()
+	if identifier == "" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos de inicio de sesión inválidos"})
+		return
+	}
 
-	// Buscar el usuario en la base de datos
-	var user models.User
-	err := db.Database.QueryRow(
-		"SELECT id, username, email, password, role FROM users WHERE username = ?",
-		req.Username,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role)
+	// Buscar el usuario por nombre o correo
+	found, loginName, err := ac.findLoginUser(identifier)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		return
+	}
 
-	// Manejar error si el usuario no existe
+	// Rechazar el intento si el usuario o la IP están bloqueados
+	if !ac.checkLoginLock(c, loginName) {
+		return
+	}
+
+	// Verificar la contraseña
+	user, err := ac.authenticateUser(found, req.Password)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == errInvalidCredentials {
+			ac.recordLoginFailure(c, loginName)
+			audit(c, models.AuditEvent{EventType: models.AuditLogin, Outcome: models.AuditFailure, ActorName: identifier, Details: "credenciales inválidas"})
 			c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Usuario o contraseña incorrectos"})
 		} else {
-			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar la contraseña"})
 		}
 		return
 	}
 
-	// Verificar la contraseña
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	// Verificar que la cuenta pueda iniciar sesión
+	if !ac.checkAccountStatus(c, user) {
+		audit(c, models.AuditEvent{EventType: models.AuditLogin, Outcome: models.AuditFailure, ActorID: user.ID, ActorName: user.Username, Details: ac.accountStatusError(user)})
+		return
+	}
+
+	// Con TOTP activo, el inicio de sesión continúa en POST /login/mfa; los
+	// fallos se reinician recién cuando también se valida el código
+	if user.TOTPEnabled {
+		ac.startMFAChallenge(c, user)
+		return
+	}
+	ac.clearLoginFailures(user.Username)
+
+	// Iniciar sesión durante el periodo de gracia cancela la eliminación de la cuenta
+	if err := ac.cancelAccountDeletion(c, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al cancelar la eliminación de la cuenta"})
+		return
+	}
+
+	// Generar los tokens para el usuario autenticado
+	response, err := ac.issueTokens(c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el token"})
+		return
+	}
+	audit(c, models.AuditEvent{EventType: models.AuditLogin, Outcome: models.AuditSuccess, ActorID: user.ID, ActorName: user.Username})
+
+	// Devolver la respuesta con los tokens
+	c.JSON(http.StatusOK, response)
+}
+
+// errInvalidCredentials indica que el usuario no existe o la contraseña no coincide
+var errInvalidCredentials = errors.New("credenciales inválidas")
+
+// findLoginUser busca al usuario de un identificador de inicio de sesión: un
+// correo si contiene '@' (o un nombre de usuario antiguo que lo contenga) y
+// si no un nombre de usuario. Devuelve nil si no existe, junto con el nombre
+// sobre el que se cuentan los fallos: el del usuario si existe, para que
+// iniciar sesión con el nombre o con el correo compartan el mismo límite.
+func (ac *AuthController) findLoginUser(identifier string) (*models.User, string, error) {
+	user, err := models.User{}, store.ErrUserNotFound
+	if strings.Contains(identifier, "@") {
+		user, err = ac.Users.FindByEmail(identifier)
+	}
+	if err == store.ErrUserNotFound {
+		user, err = ac.Users.FindByUsername(identifier)
+	}
+	if err == store.ErrUserNotFound {
+		return nil, identifier, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &user, user.Username, nil
+}
+
+// authenticateUser verifica la contraseña del usuario encontrado por
+// findLoginUser. Un usuario inexistente (nil) y una contraseña incorrecta
+// devuelven el mismo error, para no revelar qué usuarios existen (ambos
+// cuentan como intento fallido).
+func (ac *AuthController) authenticateUser(found *models.User, password string) (models.User, error) {
+	if found == nil {
+		return models.User{}, errInvalidCredentials
+	}
+	user := *found
+
+	match, needsRehash, err := ac.Passwords.Verify(password, user.Password)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !match {
+		return models.User{}, errInvalidCredentials
+	}
+
+	// Actualizar los hashes con un algoritmo o parámetros anteriores; un
+	// fallo no impide iniciar sesión, se reintenta en el siguiente inicio
+	if needsRehash {
+		if err := ac.rehashPassword(user, password); err != nil {
+			log.Printf("Error al actualizar el hash de la contraseña del usuario %d: %v", user.ID, err)
+		}
+	}
+
+	return user, nil
+}
+
+// rehashPassword vuelve a cifrar la contraseña con los parámetros actuales
+func (ac *AuthController) rehashPassword(user models.User, password string) error {
+	hash, err := ac.Passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	_, err = ac.Users.RehashPassword(user.ID, user.Password, hash)
+	return err
+}
+
+// Refresh intercambia un token de renovación por un nuevo par de tokens.
+// Cada token de renovación solo puede usarse una vez: si se presenta uno ya
+// utilizado se asume que fue robado y se revoca toda su familia.
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos de renovación inválidos"})
+		return
+	}
+
+	// Buscar el token por su hash
+	stored, err := db.FindRefreshToken(security.HashToken(req.RefreshToken))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Usuario o contraseña incorrectos"})
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Token de renovación inválido"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el token de renovación"})
+		}
 		return
 	}
-	// Generar un token JWT para el usuario autenticado
-	token, expiresAt, err := middleware.GenerateToken(user.ID, user.Username, user.Email, user.Role, ac.Config.JWTSecret)
+
+	if stored.RevokedAt.Valid {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Token de renovación revocado"})
+		return
+	}
+
+	// Un token ya utilizado indica reutilización: revocar toda la familia
+	if stored.UsedAt.Valid {
+		ac.revokeReusedFamily(c, stored)
+		return
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Token de renovación expirado"})
+		return
+	}
+
+	// Marcar el token como usado; si otra solicitud se adelantó, también es reutilización
+	marked, err := db.MarkRefreshTokenUsed(stored.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al rotar el token de renovación"})
+		return
+	}
+	if !marked {
+		ac.revokeReusedFamily(c, stored)
+		return
+	}
+
+	// Cargar los datos actuales del usuario (el rol pudo haber cambiado)
+	user, err := ac.Users.FindByID(stored.UserID)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Usuario no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		}
+		return
+	}
+	if !ac.checkAccountStatus(c, user) {
+		return
+	}
+
+	// Emitir un nuevo par de tokens dentro de la misma familia
+	response, err := ac.issueTokens(c, user, stored.FamilyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el token"})
 		return
 	}
 
-	// Devolver la respuesta con el token
-	c.JSON(http.StatusOK, models.TokenResponse{
-		Token:     token,
-		ExpiresAt: expiresAt.Format(time.RFC3339),
-		User: models.UserResponse{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Role:     user.Role,
-		},
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revoca el token de acceso actual y, opcionalmente, el token de renovación
+func (ac *AuthController) Logout(c *gin.Context) {
+	var req models.LogoutRequest
+
+	// El cuerpo es opcional, pero si se envía debe ser válido
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos de cierre de sesión inválidos"})
+			return
+		}
+	}
+
+	// Las claves de API no tienen sesión: se revocan con DELETE /api-keys/:id
+	if c.GetInt("api_key_id") != 0 {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Las claves de API no tienen sesión; revoca la clave para dejar de usarla"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+
+	// Revocar el token de acceso hasta su expiración
+	if err := middleware.Revocations.Revoke(c.GetString("jti"), userID, c.GetTime("token_expires_at")); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al revocar el token"})
+		return
+	}
+
+	// Cerrar la sesión del token: sus demás tokens de acceso y su familia de renovación
+	if sessionID := c.GetString("session_id"); sessionID != "" {
+		if err := revokeSession(sessionID, userID, ac.Config.AccessTokenTTL); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al cerrar la sesión"})
+			return
+		}
+	}
+
+	// Revocar la familia del token de renovación, solo si pertenece al usuario
+	if req.RefreshToken != "" {
+		stored, err := db.FindRefreshToken(security.HashToken(req.RefreshToken))
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el token de renovación"})
+			return
+		}
+		if err == nil && stored.UserID == userID {
+			if err := revokeSession(stored.FamilyID, userID, ac.Config.AccessTokenTTL); err != nil {
+				c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al revocar los tokens de renovación"})
+				return
+			}
+		}
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditLogout, Outcome: models.AuditSuccess})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Sesión cerrada correctamente"})
+}
+
+// revokeReusedFamily revoca la familia de un token reutilizado y responde 401
+func (ac *AuthController) revokeReusedFamily(c *gin.Context, stored *models.RefreshToken) {
+	log.Printf("Reutilización de token de renovación detectada (usuario %d, familia %s)", stored.UserID, stored.FamilyID)
+	audit(c, models.AuditEvent{
+		EventType: models.AuditRefreshReuse,
+		Outcome:   models.AuditFailure,
+		TargetID:  stored.UserID,
+		Details:   "sesión revocada: " + stored.FamilyID,
 	})
+	if err := revokeSession(stored.FamilyID, stored.UserID, ac.Config.AccessTokenTTL); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al revocar los tokens de renovación"})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Token de renovación reutilizado, se cerró la sesión"})
+}
+
+// issueTokens genera un token de acceso y un token de renovación para el usuario.
+// Si familyID está vacío se inicia una nueva familia de tokens de renovación,
+// que corresponde a una nueva sesión en el dispositivo de la solicitud.
+func (ac *AuthController) issueTokens(c *gin.Context, user models.User, familyID string) (models.TokenResponse, error) {
+	if familyID == "" {
+		var err error
+		if familyID, err = security.NewRandomID(); err != nil {
+			return models.TokenResponse{}, err
+		}
+	}
+	if err := ensureSession(c, familyID, user.ID); err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	permissions, err := db.RolePermissions(user.Role)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	token, expiresAt, err := middleware.GenerateToken(user.ID, user.Username, user.Email, user.Role, permissions, familyID, ac.Config.AccessTokenTTL)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	refreshToken, err := security.NewOpaqueToken(32)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+	refreshExpiresAt := time.Now().Add(ac.Config.RefreshTokenTTL)
+	if err := db.CreateRefreshToken(user.ID, familyID, security.HashToken(refreshToken), refreshExpiresAt); err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	return models.TokenResponse{
+		Token:            token,
+		ExpiresAt:        expiresAt.Format(time.RFC3339),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt.Format(time.RFC3339),
+		User:             userResponse(user),
+	}, nil
 }
 
 // GetProfile obtiene el perfil del usuario autenticado
@@ -158,15 +494,11 @@ func (ac *AuthController) GetProfile(c *gin.Context) {
 	}
 
 	// Buscar el usuario en la base de datos
-	var user models.User
-	err := db.Database.QueryRow(
-		"SELECT id, username, email, role FROM users WHERE id = ?",
-		userID,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Role)
+	user, err := ac.Users.FindByID(userID.(int))
 
 	// Manejar error si el usuario no existe
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == store.ErrUserNotFound {
 			c.JSON(http.StatusNotFound, models.ResponseError{Error: "Usuario no encontrado"})
 		} else {
 			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
@@ -175,10 +507,5 @@ func (ac *AuthController) GetProfile(c *gin.Context) {
 	}
 
 	// Devolver los datos del usuario
-	c.JSON(http.StatusOK, models.UserResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Role:     user.Role,
-	})
+	c.JSON(http.StatusOK, userResponse(user))
 }
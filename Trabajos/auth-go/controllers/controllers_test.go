@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"auth/config"
+	"auth/db"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openTestDB abre una base de datos SQLite en memoria, como DB_DRIVER=memory,
+// con todas las migraciones aplicadas
+func openTestDB(t *testing.T) {
+	t.Helper()
+
+	if err := db.Connect(config.Config{DBDriver: "memory"}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { db.Database.Close() })
+
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+}
+
+// newTestContext crea un contexto de gin para una solicitud desde la IP indicada
+func newTestContext(method, target, ip string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(method, target, nil)
+	c.Request.RemoteAddr = ip + ":40000"
+	return c, rec
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/mailer"
+	"auth/models"
+	"auth/security"
+	"auth/store"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestEmailChange inicia el cambio de correo del usuario autenticado. El
+// correo nuevo queda pendiente hasta confirmarlo con el enlace enviado a esa
+// dirección; al correo actual se le envía un aviso.
+func (ac *AuthController) RequestEmailChange(c *gin.Context) {
+	var req models.ChangeEmailRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos del cambio de correo inválidos"})
+		return
+	}
+	newEmail := models.NormalizeEmail(req.NewEmail)
+	if !validEmail(newEmail) {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Correo electrónico inválido"})
+		return
+	}
+
+	if c.GetInt("api_key_id") != 0 {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "No se puede cambiar el correo autenticándose con una clave de API"})
+		return
+	}
+
+	user, ok := ac.loadCurrentUser(c)
+	if !ok || !ac.checkCurrentPassword(c, user, req.Password, models.AuditEmailChangeRequested) {
+		return
+	}
+
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "El correo nuevo es igual al actual"})
+		return
+	}
+	if _, err := ac.Users.FindByEmail(newEmail); err == nil {
+		c.JSON(http.StatusConflict, models.ResponseError{Error: "El correo electrónico ya está en uso"})
+		return
+	} else if err != store.ErrUserNotFound {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		return
+	}
+
+	// Una solicitud nueva reemplaza a la anterior y anula su enlace
+	if err := ac.Users.SetPendingEmail(user.ID, newEmail); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al solicitar el cambio de correo"})
+		return
+	}
+	if err := db.InvalidateOneTimeTokens(user.ID, db.PurposeEmailChange); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al solicitar el cambio de correo"})
+		return
+	}
+
+	token, err := security.NewOpaqueToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el token"})
+		return
+	}
+	expiresAt := time.Now().Add(ac.Config.EmailChangeTTL)
+	if err := db.CreateOneTimeToken(user.ID, db.PurposeEmailChange, security.HashToken(token), newEmail, expiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al solicitar el cambio de correo"})
+		return
+	}
+
+	link := ac.Config.AppBaseURL + "/api/auth/email/confirm?token=" + url.QueryEscape(token)
+	if err := ac.Mailer.Send(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirma tu nuevo correo electrónico",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nPara usar esta dirección en tu cuenta, abre el siguiente enlace antes de %s:\n\n%s\n\nSi no solicitaste el cambio, ignora este correo.\n",
+			user.Username, expiresAt.Format(time.RFC1123), link,
+		),
+	}); err != nil {
+		log.Printf("Error al enviar la confirmación del cambio de correo al usuario %d: %v", user.ID, err)
+	}
+
+	// Avisar al correo actual, que sigue siendo el de la cuenta hasta la confirmación
+	if err := ac.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Solicitud de cambio de correo electrónico",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nSe solicitó cambiar el correo de tu cuenta a %s. El cambio solo se aplicará si se confirma desde esa dirección.\n\nSi no fuiste tú, cambia tu contraseña de inmediato.\n",
+			user.Username, newEmail,
+		),
+	}); err != nil {
+		log.Printf("Error al enviar el aviso de cambio de correo al usuario %d: %v", user.ID, err)
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditEmailChangeRequested, Outcome: models.AuditSuccess, TargetID: user.ID, Details: newEmail})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Revisa tu nuevo correo electrónico para confirmar el cambio"})
+}
+
+// ConfirmEmailChange aplica el cambio de correo pendiente usando el token del
+// enlace y envía al correo anterior un enlace para deshacerlo
+func (ac *AuthController) ConfirmEmailChange(c *gin.Context) {
+	tokenParam := c.Query("token")
+	if tokenParam == "" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de confirmación no proporcionado"})
+		return
+	}
+
+	token, ok := consumeTokenParam(c, db.PurposeEmailChange, tokenParam, "Token de confirmación inválido o expirado")
+	if !ok {
+		return
+	}
+
+	user, err := ac.Users.FindByID(token.UserID)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de confirmación inválido o expirado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		}
+		return
+	}
+
+	// El token guarda el correo solicitado: si hubo otra solicitud después, ya no es válido
+	changed, err := ac.Users.ConfirmEmailChange(user.ID, token.Data)
+	if err != nil {
+		if err == store.ErrUserExists {
+			c.JSON(http.StatusConflict, models.ResponseError{Error: "El correo electrónico ya está en uso"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al cambiar el correo"})
+		}
+		return
+	}
+	if !changed {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de confirmación inválido o expirado"})
+		return
+	}
+	ac.invalidateEmailTokens(user.ID)
+
+	audit(c, models.AuditEvent{
+		EventType: models.AuditEmailChanged,
+		Outcome:   models.AuditSuccess,
+		ActorID:   user.ID,
+		TargetID:  user.ID,
+		Details:   user.Email + " -> " + token.Data,
+	})
+
+	if err := ac.sendEmailChangeUndo(user, token.Data); err != nil {
+		log.Printf("Error al enviar el enlace para deshacer el cambio de correo al usuario %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Correo electrónico cambiado correctamente"})
+}
+
+// UndoEmailChange restaura el correo anterior usando el enlace enviado a esa
+// dirección. Como el cambio pudo hacerlo otra persona, también cierra todas
+// las sesiones y obliga a restablecer la contraseña.
+func (ac *AuthController) UndoEmailChange(c *gin.Context) {
+	tokenParam := c.Query("token")
+	if tokenParam == "" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token no proporcionado"})
+		return
+	}
+
+	token, ok := consumeTokenParam(c, db.PurposeEmailChangeUndo, tokenParam, "Token inválido o expirado")
+	if !ok {
+		return
+	}
+
+	// Datos del token: verificado, correo anterior y correo nuevo, uno por línea
+	parts := strings.SplitN(token.Data, "\n", 3)
+	if len(parts) != 3 {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token inválido o expirado"})
+		return
+	}
+	verified, _ := strconv.ParseBool(parts[0])
+	oldEmail, newEmail := parts[1], parts[2]
+
+	restored, err := ac.Users.RestoreEmail(token.UserID, newEmail, oldEmail, verified)
+	if err != nil {
+		if err == store.ErrUserExists {
+			c.JSON(http.StatusConflict, models.ResponseError{Error: "El correo anterior ya está en uso por otra cuenta"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al restaurar el correo"})
+		}
+		return
+	}
+	if !restored {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token inválido o expirado"})
+		return
+	}
+	ac.invalidateEmailTokens(token.UserID)
+
+	// Cerrar todas las sesiones y exigir una contraseña nueva
+	if err := revokeUserSessions(token.UserID, "", ac.Config.AccessTokenTTL); err != nil {
+		log.Printf("Error al cerrar las sesiones del usuario %d: %v", token.UserID, err)
+	}
+	if err := ac.Users.SetMustResetPassword(token.UserID, true); err != nil {
+		log.Printf("Error al exigir el restablecimiento de contraseña al usuario %d: %v", token.UserID, err)
+	}
+
+	audit(c, models.AuditEvent{
+		EventType: models.AuditEmailChangeUndone,
+		Outcome:   models.AuditSuccess,
+		ActorID:   token.UserID,
+		TargetID:  token.UserID,
+		Details:   newEmail + " -> " + oldEmail,
+	})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Se restauró el correo anterior. Restablece tu contraseña para volver a iniciar sesión"})
+}
+
+// sendEmailChangeUndo envía al correo anterior el enlace para deshacer el
+// cambio, válido durante EMAIL_CHANGE_UNDO_TTL
+func (ac *AuthController) sendEmailChangeUndo(user models.User, newEmail string) error {
+	token, err := security.NewOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(ac.Config.EmailChangeUndoTTL)
+	data := strconv.FormatBool(user.EmailVerified) + "\n" + user.Email + "\n" + newEmail
+	if err := db.CreateOneTimeToken(user.ID, db.PurposeEmailChangeUndo, security.HashToken(token), data, expiresAt); err != nil {
+		return err
+	}
+
+	link := ac.Config.AppBaseURL + "/api/auth/email/undo?token=" + url.QueryEscape(token)
+	return ac.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Se cambió el correo electrónico de tu cuenta",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nEl correo de tu cuenta se cambió a %s.\n\nSi no fuiste tú, abre el siguiente enlace antes de %s para recuperar esta dirección; se cerrarán todas las sesiones y deberás restablecer tu contraseña:\n\n%s\n",
+			user.Username, newEmail, expiresAt.Format(time.RFC1123), link,
+		),
+	})
+}
+
+// invalidateEmailTokens anula los enlaces de restablecimiento de contraseña e
+// inicio de sesión pendientes, que se enviaron al correo que dejó de ser de
+// la cuenta
+func (ac *AuthController) invalidateEmailTokens(userID int) {
+	for _, purpose := range []string{db.PurposePasswordReset, db.PurposeMagicLink} {
+		if err := db.InvalidateOneTimeTokens(userID, purpose); err != nil {
+			log.Printf("Error al invalidar los tokens %s del usuario %d: %v", purpose, userID, err)
+		}
+	}
+}
+
+// consumeTokenParam consume el token de un solo uso del enlace, respondiendo
+// con invalidMessage si no es válido. La transacción se confirma antes de
+// volver, para no usar la base de datos mientras sigue abierta.
+func consumeTokenParam(c *gin.Context, purpose, tokenParam, invalidMessage string) (*models.OneTimeToken, bool) {
+	tx, err := db.Database.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+		return nil, false
+	}
+	defer tx.Rollback()
+
+	token, err := db.ConsumeOneTimeToken(tx, purpose, security.HashToken(tokenParam))
+	if err != nil {
+		if err == db.ErrInvalidToken {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: invalidMessage})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+		}
+		return nil, false
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+		return nil, false
+	}
+	return token, true
+}
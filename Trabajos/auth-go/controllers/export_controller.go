@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"archive/zip"
+	"auth/db"
+	"auth/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportAccount descarga los datos personales del usuario autenticado en JSON
+// o, con ?format=zip, en un archivo ZIP con un JSON por tipo de dato
+func (ac *AuthController) ExportAccount(c *gin.Context) {
+	format, ok := parseExportFormat(c)
+	if !ok {
+		return
+	}
+
+	user, ok := ac.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	sendAccountExport(c, user, format)
+}
+
+// ExportUser descarga los datos personales de un usuario, para atender
+// solicitudes de acceso a los datos. Acepta los mismos formatos que ExportAccount.
+func (adc *AdminController) ExportUser(c *gin.Context) {
+	format, ok := parseExportFormat(c)
+	if !ok {
+		return
+	}
+
+	user, ok := adc.loadUser(c)
+	if !ok {
+		return
+	}
+
+	sendAccountExport(c, user, format)
+}
+
+// parseExportFormat obtiene el formato de ?format (json por defecto),
+// respondiendo 400 si no es válido
+func parseExportFormat(c *gin.Context) (string, bool) {
+	format := c.DefaultQuery("format", models.ExportFormatJSON)
+	if format != models.ExportFormatJSON && format != models.ExportFormatZIP {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Formato de exportación inválido (json o zip)"})
+		return "", false
+	}
+	return format, true
+}
+
+// sendAccountExport reúne los datos del usuario y los envía como archivo descargable
+func sendAccountExport(c *gin.Context, user models.User, format string) {
+	export, err := buildAccountExport(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al exportar los datos de la cuenta"})
+		return
+	}
+
+	var body []byte
+	var contentType string
+	switch format {
+	case models.ExportFormatZIP:
+		body, err = accountExportZIP(export)
+		contentType = "application/zip"
+	default:
+		body, err = json.MarshalIndent(export, "", "  ")
+		contentType = "application/json"
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al exportar los datos de la cuenta"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditAccountExported, Outcome: models.AuditSuccess, TargetID: user.ID, Details: format})
+
+	filename := fmt.Sprintf("account-%d-%s.%s", user.ID, export.ExportedAt.Format("20060102"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// buildAccountExport lee los datos guardados del usuario
+func buildAccountExport(user models.User) (models.AccountExport, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	export := models.AccountExport{ExportedAt: now, User: user}
+
+	sessions, err := db.ListUserSessions(user.ID)
+	if err != nil {
+		return export, err
+	}
+	export.Sessions = make([]models.SessionExport, len(sessions))
+	for i, session := range sessions {
+		export.Sessions[i] = models.SessionExport{Session: session}
+		if session.RevokedAt.Valid {
+			export.Sessions[i].RevokedAt = &session.RevokedAt.Time
+		}
+	}
+
+	keys, err := db.ListAPIKeys(user.ID)
+	if err != nil {
+		return export, err
+	}
+	export.APIKeys = make([]models.APIKeyResponse, len(keys))
+	for i, key := range keys {
+		export.APIKeys[i] = apiKeyResponse(key, now)
+	}
+
+	if export.AuditEvents, err = db.ListUserAuditEvents(user.ID); err != nil {
+		return export, err
+	}
+	// Los datos de otros actores, como el administrador que modificó la
+	// cuenta, no son datos personales del usuario
+	for i, event := range export.AuditEvents {
+		if event.ActorID != user.ID {
+			export.AuditEvents[i].ActorName = ""
+			export.AuditEvents[i].IP = ""
+			export.AuditEvents[i].UserAgent = ""
+		}
+	}
+
+	return export, nil
+}
+
+// accountExportZIP genera un archivo ZIP con un JSON por tipo de dato
+func accountExportZIP(export models.AccountExport) ([]byte, error) {
+	files := []struct {
+		name string
+		data any
+	}{
+		{"user.json", export.User},
+		{"sessions.json", export.Sessions},
+		{"api_keys.json", export.APIKeys},
+		{"audit_events.json", export.AuditEvents},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"auth/config"
+	"auth/middleware"
+	"auth/models"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IntrospectionController permite a otros servicios validar tokens de acceso
+// sin conocer la clave de firma
+type IntrospectionController struct {
+	Config config.Config
+}
+
+// NewIntrospectionController crea una nueva instancia del controlador de introspección
+func NewIntrospectionController(config config.Config) *IntrospectionController {
+	return &IntrospectionController{Config: config}
+}
+
+// Introspect indica si un token está activo y devuelve sus claims (RFC 7662).
+// El servicio que llama se autentica con HTTP Basic usando una de las
+// credenciales de INTROSPECTION_CLIENTS o las de un cliente OAuth con el
+// scope "introspect".
+func (ic *IntrospectionController) Introspect(c *gin.Context) {
+	authenticated, err := ic.authenticateService(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar las credenciales"})
+		return
+	}
+	if !authenticated {
+		c.Header("WWW-Authenticate", `Basic realm="introspection"`)
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Credenciales de servicio inválidas"})
+		return
+	}
+
+	var req models.IntrospectionRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token no proporcionado"})
+		return
+	}
+
+	// Un token rechazado por cualquier motivo simplemente no está activo
+	claims, err := middleware.ValidateAccessToken(req.Token)
+	if err != nil {
+		var tokenErr *middleware.TokenError
+		if !errors.As(err, &tokenErr) {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+			return
+		}
+		c.JSON(http.StatusOK, models.IntrospectionResponse{Active: false})
+		return
+	}
+
+	response := models.IntrospectionResponse{
+		Active:    true,
+		TokenType: "Bearer",
+		Username:  claims.Subject,
+		Sub:       claims.Subject,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		Exp:       claims.ExpiresAt.Unix(),
+		UserID:    claims.UserID,
+		Role:      claims.Role,
+		Email:     claims.Email,
+		ClientID:  claims.ClientID,
+		Scope:     claims.Scope,
+	}
+	if claims.IssuedAt != nil {
+		response.Iat = claims.IssuedAt.Unix()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// authenticateService comprueba las credenciales HTTP Basic del servicio
+func (ic *IntrospectionController) authenticateService(c *gin.Context) (bool, error) {
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		return false, nil
+	}
+
+	if expected, exists := ic.Config.IntrospectionClients[clientID]; exists {
+		// Comparar los hashes evita filtrar la longitud del secreto por tiempos de respuesta
+		got := sha256.Sum256([]byte(secret))
+		want := sha256.Sum256([]byte(expected))
+		return subtle.ConstantTimeCompare(got[:], want[:]) == 1, nil
+	}
+
+	client, err := authenticateOAuthClient(clientID, secret)
+	if err != nil || client == nil {
+		return false, err
+	}
+	return client.HasScope(introspectScope), nil
+}
+
+// introspectScope es el scope que permite a un cliente OAuth usar la introspección
+const introspectScope = "introspect"
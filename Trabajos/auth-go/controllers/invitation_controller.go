@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"auth/config"
+	"auth/db"
+	"auth/models"
+	"auth/security"
+	"auth/store"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateInvitation crea un código de invitación de un solo uso para un rol.
+// El código solo se devuelve en esta respuesta; en la base de datos se guarda su hash.
+func (adc *AdminController) CreateInvitation(c *gin.Context) {
+	var req models.CreateInvitationRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos de invitación inválidos"})
+		return
+	}
+	if !checkGrantableRole(c, req.Role) {
+		return
+	}
+
+	// Calcular la expiración
+	ttl := adc.Config.InvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	code, err := security.NewOpaqueToken(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el código de invitación"})
+		return
+	}
+
+	id, err := db.CreateInvitation(security.HashToken(code), req.Role, req.Email, c.GetInt("user_id"), expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al crear la invitación"})
+		return
+	}
+
+	invitation, err := db.FindInvitation(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar la invitación"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditInvitationCreated, Outcome: models.AuditSuccess, Details: "rol: " + req.Role})
+	c.JSON(http.StatusCreated, models.CreateInvitationResponse{
+		Code:       code,
+		Invitation: *invitation,
+	})
+}
+
+// ListInvitations lista todas las invitaciones con su estado
+func (adc *AdminController) ListInvitations(c *gin.Context) {
+	invitations, err := db.ListInvitations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al listar las invitaciones"})
+		return
+	}
+
+	now := time.Now()
+	response := make([]models.InvitationResponse, 0, len(invitations))
+	for _, inv := range invitations {
+		status := "pending"
+		if inv.UsedAt.Valid {
+			status = "used"
+		} else if !inv.IsUsable(now) {
+			status = "expired"
+		}
+		response = append(response, models.InvitationResponse{Invitation: inv, Status: status})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeInvitation elimina una invitación que todavía no se ha usado
+func (adc *AdminController) RevokeInvitation(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	invitation, err := db.FindInvitation(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ResponseError{Error: "Invitación no encontrada"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar la invitación"})
+		}
+		return
+	}
+
+	// Las invitaciones usadas se conservan como registro de quién otorgó el rol
+	if invitation.UsedAt.Valid {
+		c.JSON(http.StatusConflict, models.ResponseError{Error: "La invitación ya fue utilizada"})
+		return
+	}
+
+	if _, err := db.DeleteInvitation(id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al revocar la invitación"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditInvitationRevoked, Outcome: models.AuditSuccess, Details: "id: " + strconv.Itoa(id)})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Invitación revocada correctamente"})
+}
+
+// EnsureBootstrapInvitation crea una invitación de administrador cuando
+// todavía no existe ningún administrador, ya que el registro sin invitación
+// solo crea cuentas con el rol "user". El código no se muestra en el log: se
+// guarda en BOOTSTRAP_INVITATION_FILE. Mientras la invitación inicial siga
+// vigente no se crea otra, de modo que las réplicas que arrancan a la vez o
+// los reinicios no invalidan el código ya entregado.
+func EnsureBootstrapInvitation(cfg config.Config, users store.UserStore) error {
+	admins, err := users.CountByRole(models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		// El código ya no sirve: no dejarlo en el disco
+		if err := os.Remove(cfg.BootstrapInvitationFile); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error al eliminar %s: %v", cfg.BootstrapInvitationFile, err)
+		}
+		return nil
+	}
+
+	usable, err := db.CountUsableBootstrapInvitations()
+	if err != nil {
+		return err
+	}
+	if usable > 0 {
+		log.Printf("No hay administradores registrados. El código de invitación de administrador vigente está en %s",
+			cfg.BootstrapInvitationFile)
+		return nil
+	}
+
+	expired, err := db.DeleteExpiredBootstrapInvitations()
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		log.Printf("Se eliminaron %d invitaciones de administrador iniciales expiradas", expired)
+	}
+
+	code, err := security.NewOpaqueToken(24)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(cfg.InvitationTTL)
+	if _, err := db.CreateInvitation(security.HashToken(code), models.RoleAdmin, "", 0, expiresAt); err != nil {
+		return err
+	}
+	if err := writeBootstrapCode(cfg.BootstrapInvitationFile, code); err != nil {
+		return err
+	}
+
+	log.Printf("No hay administradores registrados. El código de invitación de administrador (válido hasta %s) está en %s",
+		expiresAt.Format(time.RFC3339), cfg.BootstrapInvitationFile)
+	return nil
+}
+
+// writeBootstrapCode guarda el código en un archivo nuevo que solo puede leer
+// el usuario del servicio. Se elimina antes el anterior, para no heredar sus
+// permisos.
+func writeBootstrapCode(path, code string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(code + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
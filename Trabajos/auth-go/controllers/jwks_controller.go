@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"auth/middleware"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publica las claves públicas con las que se verifican los tokens.
+// Con firma HS256 la lista está vacía, ya que el secreto no puede publicarse.
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, middleware.Keys.JWKS())
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/models"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginKeys devuelve los identificadores sobre los que se cuentan los fallos:
+// el nombre de usuario (sin distinguir mayúsculas) y la IP del cliente
+func loginKeys(c *gin.Context, username string) map[string]string {
+	return map[string]string{
+		db.LoginScopeUser: strings.ToLower(strings.TrimSpace(username)),
+		db.LoginScopeIP:   c.ClientIP(),
+	}
+}
+
+// checkLoginLock responde con 429 y Retry-After si el usuario o la IP están bloqueados
+func (ac *AuthController) checkLoginLock(c *gin.Context, username string) bool {
+	retryAfter, err := ac.loginLockWait(c, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar los intentos de inicio de sesión"})
+		return false
+	}
+
+	if retryAfter > 0 {
+		audit(c, models.AuditEvent{EventType: models.AuditLogin, Outcome: models.AuditFailure, ActorName: username, Details: "bloqueado por intentos fallidos"})
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, models.ResponseError{Error: "Demasiados intentos fallidos. Intenta de nuevo más tarde"})
+		return false
+	}
+
+	return true
+}
+
+// loginLockWait devuelve cuánto falta para que termine el bloqueo más largo
+// que afecta al usuario o a la IP (cero si no hay bloqueo)
+func (ac *AuthController) loginLockWait(c *gin.Context, username string) (time.Duration, error) {
+	now := time.Now()
+	var retryAfter time.Duration
+
+	for scope, identifier := range loginKeys(c, username) {
+		lockedUntil, err := db.GetLoginLock(scope, identifier)
+		if err != nil {
+			return 0, err
+		}
+		if wait := lockedUntil.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// recordLoginFailure registra un intento fallido para el usuario y la IP y,
+// si se supera el límite, los bloquea con una espera que se duplica en cada
+// fallo adicional (hasta LoginLockoutMax)
+func (ac *AuthController) recordLoginFailure(c *gin.Context, username string) {
+	limits := map[string]int{
+		db.LoginScopeUser: ac.Config.LoginMaxFailures,
+		db.LoginScopeIP:   ac.Config.LoginMaxFailuresPerIP,
+	}
+	resetBefore := time.Now().Add(-ac.Config.LoginFailureWindow)
+
+	for scope, identifier := range loginKeys(c, username) {
+		failures, err := db.RecordLoginFailure(scope, identifier, resetBefore)
+		if err != nil {
+			log.Printf("Error al registrar el intento fallido (%s %s): %v", scope, identifier, err)
+			continue
+		}
+
+		excess := failures - limits[scope]
+		if excess < 0 {
+			continue
+		}
+
+		lockout := ac.Config.LoginLockoutBase
+		for i := 0; i < excess && lockout < ac.Config.LoginLockoutMax; i++ {
+			lockout *= 2
+		}
+		lockout = min(lockout, ac.Config.LoginLockoutMax)
+
+		if err := db.LockLogin(scope, identifier, time.Now().Add(lockout)); err != nil {
+			log.Printf("Error al bloquear el inicio de sesión (%s %s): %v", scope, identifier, err)
+		}
+	}
+}
+
+// clearLoginFailures reinicia el conteo del usuario tras un inicio de sesión
+// correcto. El conteo por IP no se reinicia: se descarta al pasar LoginFailureWindow,
+// para que acertar con una cuenta propia no permita seguir probando otras.
+func (ac *AuthController) clearLoginFailures(username string) {
+	if err := db.ClearLoginFailures(db.LoginScopeUser, strings.ToLower(strings.TrimSpace(username))); err != nil {
+		log.Printf("Error al reiniciar los intentos fallidos de %s: %v", username, err)
+	}
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"auth/config"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLoginLockout(t *testing.T) {
+	cfg := config.Config{
+		LoginMaxFailures:      3,
+		LoginMaxFailuresPerIP: 10,
+		LoginFailureWindow:    time.Hour,
+		LoginLockoutBase:      time.Minute,
+		LoginLockoutMax:       5 * time.Minute,
+	}
+
+	tests := []struct {
+		name     string
+		failures int
+		wantWait time.Duration // Bloqueo esperado tras los fallos (cero si no hay)
+	}{
+		{"por debajo del límite", 2, 0},
+		{"en el límite", 3, time.Minute},
+		{"un fallo de más duplica la espera", 4, 2 * time.Minute},
+		{"dos fallos de más", 5, 4 * time.Minute},
+		{"la espera no supera el máximo", 8, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			ac := &AuthController{Config: cfg}
+
+			for range tt.failures {
+				c, _ := newTestContext(http.MethodPost, "/api/auth/login", "192.0.2.1")
+				ac.recordLoginFailure(c, "Maria")
+			}
+
+			// El bloqueo se aplica al nombre sin distinguir mayúsculas, desde cualquier IP
+			c, _ := newTestContext(http.MethodPost, "/api/auth/login", "198.51.100.7")
+			wait, err := ac.loginLockWait(c, " maria ")
+			if err != nil {
+				t.Fatalf("loginLockWait: %v", err)
+			}
+			if tt.wantWait == 0 {
+				if wait != 0 {
+					t.Errorf("espera = %v, no se esperaba bloqueo", wait)
+				}
+				return
+			}
+			if wait <= tt.wantWait-5*time.Second || wait > tt.wantWait {
+				t.Errorf("espera = %v, se esperaba cerca de %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	openTestDB(t)
+	ac := &AuthController{Config: config.Config{
+		LoginMaxFailures:      100,
+		LoginMaxFailuresPerIP: 3,
+		LoginFailureWindow:    time.Hour,
+		LoginLockoutBase:      time.Minute,
+		LoginLockoutMax:       time.Hour,
+	}}
+
+	// Fallos con usuarios distintos desde la misma IP
+	for _, username := range []string{"ana", "luis", "eva"} {
+		c, _ := newTestContext(http.MethodPost, "/api/auth/login", "203.0.113.5")
+		ac.recordLoginFailure(c, username)
+	}
+
+	tests := []struct {
+		name     string
+		ip       string
+		username string
+		locked   bool
+	}{
+		{"misma IP, otro usuario", "203.0.113.5", "pedro", true},
+		{"otra IP, usuario usado", "203.0.113.6", "ana", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(http.MethodPost, "/api/auth/login", tt.ip)
+			wait, err := ac.loginLockWait(c, tt.username)
+			if err != nil {
+				t.Fatalf("loginLockWait: %v", err)
+			}
+			if locked := wait > 0; locked != tt.locked {
+				t.Errorf("bloqueado = %v, se esperaba %v", locked, tt.locked)
+			}
+		})
+	}
+
+	// Acertar con una cuenta no reinicia el conteo por IP
+	ac.clearLoginFailures("ana")
+	c, _ := newTestContext(http.MethodPost, "/api/auth/login", "203.0.113.5")
+	if wait, _ := ac.loginLockWait(c, "pedro"); wait == 0 {
+		t.Error("clearLoginFailures no debe desbloquear la IP")
+	}
+}
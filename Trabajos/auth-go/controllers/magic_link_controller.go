@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/mailer"
+	"auth/models"
+	"auth/security"
+	"auth/store"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMagicLink envía un enlace de inicio de sesión sin contraseña.
+// Siempre responde lo mismo para no revelar qué correos están registrados.
+func (ac *AuthController) RequestMagicLink(c *gin.Context) {
+	var req models.MagicLinkRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Correo electrónico inválido"})
+		return
+	}
+
+	response := models.MessageResponse{Message: "Si el correo está registrado, recibirás un enlace para iniciar sesión"}
+
+	user, err := ac.Users.FindByEmail(req.Email)
+	if err != nil {
+		if err != store.ErrUserNotFound {
+			log.Printf("Error al buscar el usuario para el enlace de inicio de sesión: %v", err)
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// No enviar enlaces a cuentas que no pueden iniciar sesión; la
+	// verificación del correo no cuenta, porque abrir el enlace la completa
+	if user.Disabled || user.MustResetPassword {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	if err := ac.sendMagicLink(user); err != nil {
+		log.Printf("Error al enviar el enlace de inicio de sesión al usuario %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// sendMagicLink invalida los enlaces anteriores y envía uno nuevo
+func (ac *AuthController) sendMagicLink(user models.User) error {
+	if err := db.InvalidateOneTimeTokens(user.ID, db.PurposeMagicLink); err != nil {
+		return err
+	}
+
+	token, err := security.NewOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+	// El token guarda el correo al que se envió, para invalidarlo si el correo cambia
+	expiresAt := time.Now().Add(ac.Config.MagicLinkTTL)
+	if err := db.CreateOneTimeToken(user.ID, db.PurposeMagicLink, security.HashToken(token), user.Email, expiresAt); err != nil {
+		return err
+	}
+
+	link := ac.Config.AppBaseURL + "/api/auth/magic-link/consume?token=" + url.QueryEscape(token)
+	return ac.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Tu enlace para iniciar sesión",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nAbre el siguiente enlace antes de %s para iniciar sesión. Solo puede usarse una vez:\n\n%s\n\nSi no lo solicitaste, ignora este correo.\n",
+			user.Username, expiresAt.Format(time.RFC1123), link,
+		),
+	})
+}
+
+// ConsumeMagicLink inicia sesión con el token del enlace y devuelve la misma
+// respuesta que Login. Si el usuario tiene TOTP activo, el enlace reemplaza
+// solo a la contraseña y el inicio de sesión continúa en POST /login/mfa.
+func (ac *AuthController) ConsumeMagicLink(c *gin.Context) {
+	tokenParam := c.Query("token")
+	if tokenParam == "" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de inicio de sesión no proporcionado"})
+		return
+	}
+
+	token, ok := consumeTokenParam(c, db.PurposeMagicLink, tokenParam, "Enlace de inicio de sesión inválido o expirado")
+	if !ok {
+		return
+	}
+
+	user, err := ac.Users.FindByID(token.UserID)
+	if err != nil && err != store.ErrUserNotFound {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		return
+	}
+	if err == store.ErrUserNotFound || user.Email != token.Data {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Enlace de inicio de sesión inválido o expirado"})
+		return
+	}
+
+	// Abrir el enlace demuestra que el correo pertenece al usuario
+	if !user.EmailVerified {
+		verified, err := ac.Users.MarkEmailVerified(user.ID, user.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el correo"})
+			return
+		}
+		user.EmailVerified = verified
+	}
+
+	// Verificar que la cuenta pueda iniciar sesión
+	if !ac.checkAccountStatus(c, user) {
+		audit(c, models.AuditEvent{EventType: models.AuditMagicLinkLogin, Outcome: models.AuditFailure, ActorID: user.ID, ActorName: user.Username, Details: ac.accountStatusError(user)})
+		return
+	}
+
+	if user.TOTPEnabled {
+		ac.startMFAChallenge(c, user)
+		return
+	}
+
+	// Iniciar sesión durante el periodo de gracia cancela la eliminación de la cuenta
+	if err := ac.cancelAccountDeletion(c, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al cancelar la eliminación de la cuenta"})
+		return
+	}
+
+	response, err := ac.issueTokens(c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el token"})
+		return
+	}
+	audit(c, models.AuditEvent{EventType: models.AuditMagicLinkLogin, Outcome: models.AuditSuccess, ActorID: user.ID, ActorName: user.Username})
+
+	c.JSON(http.StatusOK, response)
+}
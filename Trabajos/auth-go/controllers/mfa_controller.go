@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/models"
+	"auth/security"
+	"auth/store"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cantidad de códigos de recuperación generados al activar TOTP
+const recoveryCodeCount = 10
+
+// EnrollTOTP genera un nuevo secreto TOTP pendiente de confirmación.
+// Requiere la contraseña actual.
+func (ac *AuthController) EnrollTOTP(c *gin.Context) {
+	var req models.TOTPEnrollRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Contraseña no proporcionada"})
+		return
+	}
+
+	if c.GetInt("api_key_id") != 0 {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "No se puede activar la autenticación en dos pasos autenticándose con una clave de API"})
+		return
+	}
+
+	user, ok := ac.loadCurrentUser(c)
+	if !ok || !ac.checkCurrentPassword(c, user, req.Password, models.AuditTOTPEnabled) {
+		return
+	}
+	userID := user.ID
+
+	state, err := ac.Users.GetTOTP(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al consultar la autenticación en dos pasos"})
+		return
+	}
+	if state.Enabled {
+		c.JSON(http.StatusConflict, models.ResponseError{Error: "La autenticación en dos pasos ya está activa"})
+		return
+	}
+
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el secreto"})
+		return
+	}
+	if err := ac.Users.SetPendingTOTPSecret(userID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al guardar el secreto"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: security.TOTPURI(ac.Config.TOTPIssuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP activa TOTP tras comprobar un código y devuelve los códigos de recuperación
+func (ac *AuthController) ConfirmTOTP(c *gin.Context) {
+	var req models.TOTPCodeRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Código inválido"})
+		return
+	}
+
+	if c.GetInt("api_key_id") != 0 {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "No se puede activar la autenticación en dos pasos autenticándose con una clave de API"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	state, err := ac.Users.GetTOTP(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al consultar la autenticación en dos pasos"})
+		return
+	}
+	if state.Enabled {
+		c.JSON(http.StatusConflict, models.ResponseError{Error: "La autenticación en dos pasos ya está activa"})
+		return
+	}
+	if state.Secret == "" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Primero debes iniciar la activación de la autenticación en dos pasos"})
+		return
+	}
+
+	step, ok := security.ValidateTOTP(state.Secret, strings.TrimSpace(req.Code), time.Now(), state.LastStep)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Código inválido"})
+		return
+	}
+
+	codes, err := security.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar los códigos de recuperación"})
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = security.HashToken(code)
+	}
+
+	// Guardar los códigos antes de activar TOTP: si la activación falla, no se usan
+	if err := db.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al guardar los códigos de recuperación"})
+		return
+	}
+	if err := ac.Users.EnableTOTP(userID, step); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al activar la autenticación en dos pasos"})
+		return
+	}
+	audit(c, models.AuditEvent{EventType: models.AuditTOTPEnabled, Outcome: models.AuditSuccess, TargetID: userID})
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP desactiva TOTP; requiere un código TOTP o de recuperación válido
+func (ac *AuthController) DisableTOTP(c *gin.Context) {
+	var req models.TOTPCodeRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Código inválido"})
+		return
+	}
+
+	if c.GetInt("api_key_id") != 0 {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "No se puede desactivar la autenticación en dos pasos autenticándose con una clave de API"})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	valid, err := ac.verifySecondFactor(userID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el código"})
+		return
+	}
+	if !valid {
+		audit(c, models.AuditEvent{EventType: models.AuditTOTPDisabled, Outcome: models.AuditFailure, TargetID: userID, Details: "código inválido"})
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Código inválido"})
+		return
+	}
+
+	if err := ac.Users.DisableTOTP(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al desactivar la autenticación en dos pasos"})
+		return
+	}
+	if err := db.DeleteRecoveryCodes(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al eliminar los códigos de recuperación"})
+		return
+	}
+	audit(c, models.AuditEvent{EventType: models.AuditTOTPDisabled, Outcome: models.AuditSuccess, TargetID: userID})
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Autenticación en dos pasos desactivada"})
+}
+
+// LoginMFA completa el inicio de sesión intercambiando el mfa_token y un
+// código TOTP o de recuperación por los tokens definitivos
+func (ac *AuthController) LoginMFA(c *gin.Context) {
+	var req models.MFALoginRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos de inicio de sesión inválidos"})
+		return
+	}
+
+	// El mfa_token se consume aunque el código sea incorrecto, de modo que
+	// cada intento de adivinar el código exige volver a enviar la contraseña
+	tx, err := db.Database.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+		return
+	}
+	defer tx.Rollback()
+
+	token, err := db.ConsumeOneTimeToken(tx, db.PurposeMFALogin, security.HashToken(req.MFAToken))
+	if err != nil {
+		if err == db.ErrInvalidToken {
+			c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Token de verificación en dos pasos inválido o expirado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+		}
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+		return
+	}
+
+	user, err := ac.Users.FindByID(token.UserID)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Usuario no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		}
+		return
+	}
+	if !ac.checkAccountStatus(c, user) || !ac.checkLoginLock(c, user.Username) {
+		return
+	}
+
+	valid, err := ac.verifySecondFactor(user.ID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el código"})
+		return
+	}
+	if !valid {
+		ac.recordLoginFailure(c, user.Username)
+		audit(c, models.AuditEvent{EventType: models.AuditLoginMFA, Outcome: models.AuditFailure, ActorID: user.ID, ActorName: user.Username, Details: "código inválido"})
+		c.JSON(http.StatusUnauthorized, models.ResponseError{Error: "Código inválido, inicia sesión de nuevo"})
+		return
+	}
+	ac.clearLoginFailures(user.Username)
+
+	if err := ac.cancelAccountDeletion(c, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al cancelar la eliminación de la cuenta"})
+		return
+	}
+
+	response, err := ac.issueTokens(c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el token"})
+		return
+	}
+	audit(c, models.AuditEvent{EventType: models.AuditLoginMFA, Outcome: models.AuditSuccess, ActorID: user.ID, ActorName: user.Username})
+
+	c.JSON(http.StatusOK, response)
+}
+
+// startMFAChallenge responde al primer paso del inicio de sesión con un
+// mfa_token de corta duración en lugar de los tokens definitivos
+func (ac *AuthController) startMFAChallenge(c *gin.Context, user models.User) {
+	mfaToken, err := security.NewOpaqueToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el token"})
+		return
+	}
+
+	expiresAt := time.Now().Add(ac.Config.MFATokenTTL)
+	if err := db.CreateOneTimeToken(user.ID, db.PurposeMFALogin, security.HashToken(mfaToken), "", expiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar el token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresAt:   expiresAt.Format(time.RFC3339),
+	})
+}
+
+// verifySecondFactor acepta un código TOTP vigente (no usado antes) o un
+// código de recuperación sin usar
+func (ac *AuthController) verifySecondFactor(userID int, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	state, err := ac.Users.GetTOTP(userID)
+	if err != nil {
+		return false, err
+	}
+	if !state.Enabled {
+		return false, nil
+	}
+
+	if step, ok := security.ValidateTOTP(state.Secret, code, time.Now(), state.LastStep); ok {
+		// Registrar el paso evita que el mismo código se use dos veces
+		return ac.Users.AdvanceTOTPStep(userID, step)
+	}
+
+	return db.UseRecoveryCode(userID, security.HashToken(strings.ToLower(code)))
+}
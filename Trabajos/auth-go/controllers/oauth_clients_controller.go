@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/models"
+	"auth/security"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CreateOAuthClient registra un cliente OAuth con los scopes que puede solicitar.
+// El secreto solo se devuelve en esta respuesta; en la base de datos se guarda su hash.
+// Los clientes públicos no reciben secreto y solo pueden usar el flujo de código con PKCE.
+func (adc *AdminController) CreateOAuthClient(c *gin.Context) {
+	var req models.CreateOAuthClientRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos del cliente inválidos"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !models.IsValidScope(scope) {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Scope inválido: " + scope})
+			return
+		}
+	}
+	for _, uri := range req.RedirectURIs {
+		if !isValidRedirectURI(uri) {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "URI de redirección inválida: " + uri})
+			return
+		}
+	}
+	if req.Public && len(req.RedirectURIs) == 0 {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Un cliente público debe indicar sus URIs de redirección"})
+		return
+	}
+
+	clientID, err := security.NewRandomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar las credenciales"})
+		return
+	}
+
+	var secret, secretHash string
+	if !req.Public {
+		secret, err = security.NewOpaqueToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al generar las credenciales"})
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al procesar el secreto"})
+			return
+		}
+		secretHash = string(hash)
+	}
+
+	id, err := db.CreateOAuthClient(clientID, secretHash, req, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al registrar el cliente"})
+		return
+	}
+
+	client, err := db.FindOAuthClient(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el cliente"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditOAuthClientCreated, Outcome: models.AuditSuccess, Details: clientID})
+	c.JSON(http.StatusCreated, models.CreateOAuthClientResponse{
+		ClientID:     clientID,
+		ClientSecret: secret,
+		Client:       *client,
+	})
+}
+
+// ListOAuthClients lista los clientes OAuth registrados
+func (adc *AdminController) ListOAuthClients(c *gin.Context) {
+	clients, err := db.ListOAuthClients()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al listar los clientes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, clients)
+}
+
+// DeleteOAuthClient elimina un cliente OAuth; sus tokens dejan de ser aceptados
+func (adc *AdminController) DeleteOAuthClient(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := db.DeleteOAuthClient(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al eliminar el cliente"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, models.ResponseError{Error: "Cliente no encontrado"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditOAuthClientDeleted, Outcome: models.AuditSuccess, Details: "id: " + strconv.Itoa(id)})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Cliente eliminado correctamente"})
+}
+
+// isValidRedirectURI acepta URIs absolutas http(s) sin fragmento
+func isValidRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && u.Fragment == "" && !strings.ContainsAny(uri, " \t")
+}
+
+// authenticateOAuthClient comprueba las credenciales de un cliente OAuth.
+// Devuelve nil si el cliente no existe, está deshabilitado, es público o el secreto no coincide.
+func authenticateOAuthClient(clientID, secret string) (*models.OAuthClient, error) {
+	client, err := db.FindOAuthClientByClientID(clientID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Disabled || client.Public || bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(secret)) != nil {
+		return nil, nil
+	}
+
+	return client, nil
+}
+
+// findPublicOAuthClient busca un cliente público habilitado. Devuelve nil si no
+// existe o si es un cliente confidencial, que debe autenticarse con su secreto.
+func findPublicOAuthClient(clientID string) (*models.OAuthClient, error) {
+	client, err := db.FindOAuthClientByClientID(clientID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Disabled || !client.Public {
+		return nil, nil
+	}
+
+	return client, nil
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"auth/config"
+	"auth/middleware"
+	"auth/models"
+	"crypto/rand"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthController implementa los endpoints OAuth2 y OpenID Connect
+type OAuthController struct {
+	Config  config.Config
+	auth    *AuthController // Comprobaciones de inicio de sesión compartidas con Login
+	csrfKey []byte          // Clave de los tokens CSRF de la página de autorización
+}
+
+// NewOAuthController crea una nueva instancia del controlador OAuth2
+func NewOAuthController(config config.Config, auth *AuthController) *OAuthController {
+	csrfKey := []byte(config.OIDCCSRFSecret)
+	if len(csrfKey) == 0 {
+		// rand.Read no falla: si no puede leer, termina el programa
+		csrfKey = make([]byte, 32)
+		rand.Read(csrfKey)
+	}
+	return &OAuthController{Config: config, auth: auth, csrfKey: csrfKey}
+}
+
+// Token emite tokens de acceso (RFC 6749). Admite el grant client_credentials,
+// con el que un servicio obtiene un token sin un usuario, y authorization_code
+// (OpenID Connect), que además devuelve un id_token.
+func (oc *OAuthController) Token(c *gin.Context) {
+	// Las respuestas con tokens no deben guardarse en caché
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req models.OAuthTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.OAuthError{Error: "invalid_request", ErrorDescription: "falta grant_type"})
+		return
+	}
+
+	switch req.GrantType {
+	case "client_credentials":
+		oc.clientCredentials(c, req)
+	case "authorization_code":
+		if oc.Config.JWTAlgorithm == "HS256" {
+			c.JSON(http.StatusBadRequest, models.OAuthError{Error: "unsupported_grant_type"})
+			return
+		}
+		oc.authorizationCode(c, req)
+	default:
+		c.JSON(http.StatusBadRequest, models.OAuthError{Error: "unsupported_grant_type"})
+	}
+}
+
+// clientCredentials emite un token para el cliente con los scopes solicitados
+// (o todos los permitidos si no se indica scope)
+func (oc *OAuthController) clientCredentials(c *gin.Context, req models.OAuthTokenRequest) {
+	client, ok := oc.authenticateClient(c, req, false)
+	if !ok {
+		return
+	}
+
+	scopes := client.Scopes
+	if req.Scope != "" {
+		scopes = strings.Fields(req.Scope)
+		for _, scope := range scopes {
+			if !client.HasScope(scope) {
+				c.JSON(http.StatusBadRequest, models.OAuthError{Error: "invalid_scope", ErrorDescription: "scope no permitido: " + scope})
+				return
+			}
+		}
+	}
+
+	token, _, err := middleware.GenerateClientToken(client.ClientID, scopes, oc.Config.AccessTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.OAuthError{Error: "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(oc.Config.AccessTokenTTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+// authenticateClient obtiene las credenciales del cliente de la cabecera HTTP
+// Basic o, en su defecto, de los parámetros client_id y client_secret. Si
+// allowPublic es true, un cliente público se identifica solo con client_id.
+func (oc *OAuthController) authenticateClient(c *gin.Context, req models.OAuthTokenRequest, allowPublic bool) (*models.OAuthClient, bool) {
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID, secret = req.ClientID, req.ClientSecret
+	}
+
+	var client *models.OAuthClient
+	var err error
+	switch {
+	case clientID != "" && secret != "":
+		client, err = authenticateOAuthClient(clientID, secret)
+	case clientID != "" && allowPublic:
+		client, err = findPublicOAuthClient(clientID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.OAuthError{Error: "server_error"})
+		return nil, false
+	}
+	if client != nil {
+		return client, true
+	}
+
+	c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	c.JSON(http.StatusUnauthorized, models.OAuthError{Error: "invalid_client"})
+	return nil, false
+}
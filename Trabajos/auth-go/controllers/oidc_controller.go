@@ -0,0 +1,450 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/middleware"
+	"auth/models"
+	"auth/security"
+	"auth/store"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	_ "embed"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+//go:embed templates/authorize.html
+var authorizeTemplateSource string
+
+// authorizeTemplate es la página de inicio de sesión del endpoint de autorización
+var authorizeTemplate = template.Must(template.New("authorize").Parse(authorizeTemplateSource))
+
+// authorizePage son los datos con los que se muestra la página de autorización
+type authorizePage struct {
+	Request    models.AuthorizeRequest
+	CSRFToken  string // Lo completa renderAuthorize
+	ClientName string
+	Username   string
+	AskCode    bool   // El usuario tiene TOTP activo
+	Error      string // Mensaje mostrado sobre el formulario
+	Fatal      bool   // La solicitud no puede continuar; no se muestra el formulario
+}
+
+// Authorize muestra la página de inicio de sesión del flujo de código de
+// autorización (OpenID Connect con PKCE)
+func (oc *OAuthController) Authorize(c *gin.Context) {
+	req, client, ok := oc.parseAuthorizeRequest(c)
+	if !ok {
+		return
+	}
+
+	oc.renderAuthorize(c, http.StatusOK, authorizePage{Request: req, ClientName: client.Name})
+}
+
+// AuthorizeSubmit procesa el formulario de inicio de sesión con las mismas
+// comprobaciones que Login (bloqueos, estado de la cuenta y TOTP) y redirige a
+// la aplicación con un código de autorización de un solo uso
+func (oc *OAuthController) AuthorizeSubmit(c *gin.Context) {
+	req, client, ok := oc.parseAuthorizeRequest(c)
+	if !ok {
+		return
+	}
+
+	identifier := strings.TrimSpace(c.PostForm("username"))
+	page := authorizePage{Request: req, ClientName: client.Name, Username: identifier}
+
+	// El formulario debe venir de la página mostrada a este mismo navegador
+	if !oc.checkAuthorizeCSRF(c, req) {
+		page.Error = "La página de inicio de sesión expiró. Vuelve a intentarlo"
+		oc.renderAuthorize(c, http.StatusForbidden, page)
+		return
+	}
+
+	// Buscar el usuario por nombre o correo
+	found, loginName, err := oc.auth.findLoginUser(identifier)
+	if err != nil {
+		page.Error = "Error al buscar el usuario"
+		oc.renderAuthorize(c, http.StatusInternalServerError, page)
+		return
+	}
+
+	// Rechazar el intento si el usuario o la IP están bloqueados
+	retryAfter, err := oc.auth.loginLockWait(c, loginName)
+	if err != nil {
+		page.Error = "Error al verificar los intentos de inicio de sesión"
+		oc.renderAuthorize(c, http.StatusInternalServerError, page)
+		return
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		page.Error = "Demasiados intentos fallidos. Intenta de nuevo más tarde"
+		oc.renderAuthorize(c, http.StatusTooManyRequests, page)
+		return
+	}
+
+	user, err := oc.auth.authenticateUser(found, c.PostForm("password"))
+	if err != nil {
+		if err == errInvalidCredentials {
+			oc.auth.recordLoginFailure(c, loginName)
+			audit(c, models.AuditEvent{EventType: models.AuditOIDCLogin, Outcome: models.AuditFailure, ActorName: identifier, Details: "credenciales inválidas (" + client.ClientID + ")"})
+			page.Error = "Usuario o contraseña incorrectos"
+			oc.renderAuthorize(c, http.StatusUnauthorized, page)
+		} else {
+			page.Error = "Error al verificar la contraseña"
+			oc.renderAuthorize(c, http.StatusInternalServerError, page)
+		}
+		return
+	}
+
+	if message := oc.auth.accountStatusError(user); message != "" {
+		audit(c, models.AuditEvent{EventType: models.AuditOIDCLogin, Outcome: models.AuditFailure, ActorID: user.ID, ActorName: user.Username, Details: message})
+		page.Error = message
+		oc.renderAuthorize(c, http.StatusForbidden, page)
+		return
+	}
+
+	// Con TOTP activo se pide el código en el mismo formulario
+	if user.TOTPEnabled {
+		page.AskCode = true
+		code := strings.TrimSpace(c.PostForm("code"))
+		if code == "" {
+			page.Error = "Introduce el código de verificación en dos pasos"
+			oc.renderAuthorize(c, http.StatusOK, page)
+			return
+		}
+
+		valid, err := oc.auth.verifySecondFactor(user.ID, code)
+		if err != nil {
+			page.Error = "Error al verificar el código"
+			oc.renderAuthorize(c, http.StatusInternalServerError, page)
+			return
+		}
+		if !valid {
+			oc.auth.recordLoginFailure(c, user.Username)
+			audit(c, models.AuditEvent{EventType: models.AuditOIDCLogin, Outcome: models.AuditFailure, ActorID: user.ID, ActorName: user.Username, Details: "código inválido (" + client.ClientID + ")"})
+			page.Error = "Código inválido"
+			oc.renderAuthorize(c, http.StatusUnauthorized, page)
+			return
+		}
+	}
+	oc.auth.clearLoginFailures(user.Username)
+
+	if err := oc.auth.cancelAccountDeletion(c, &user); err != nil {
+		log.Printf("Error al cancelar la eliminación de la cuenta %d: %v", user.ID, err)
+		oc.redirectAuthorize(c, req, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	code, err := security.NewOpaqueToken(32)
+	if err != nil {
+		oc.redirectAuthorize(c, req, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	now := time.Now()
+	err = db.CreateAuthorizationCode(security.HashToken(code), models.AuthorizationCode{
+		ClientID:      client.ClientID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(oc.Config.AuthorizationCodeTTL),
+	})
+	if err != nil {
+		log.Printf("Error al guardar el código de autorización: %v", err)
+		oc.redirectAuthorize(c, req, url.Values{"error": {"server_error"}})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditOIDCLogin, Outcome: models.AuditSuccess, ActorID: user.ID, ActorName: user.Username, Details: client.ClientID})
+	oc.redirectAuthorize(c, req, url.Values{"code": {code}})
+}
+
+// parseAuthorizeRequest valida los parámetros de autorización. Mientras el
+// cliente o la URI de redirección no sean válidos el error se muestra en la
+// página; los demás errores se devuelven a la aplicación por la redirección.
+func (oc *OAuthController) parseAuthorizeRequest(c *gin.Context) (models.AuthorizeRequest, *models.OAuthClient, bool) {
+	var req models.AuthorizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		oc.renderAuthorize(c, http.StatusBadRequest, authorizePage{Fatal: true, Error: "Parámetros de autorización inválidos"})
+		return req, nil, false
+	}
+
+	client, err := db.FindOAuthClientByClientID(req.ClientID)
+	if err != nil && err != sql.ErrNoRows {
+		oc.renderAuthorize(c, http.StatusInternalServerError, authorizePage{Fatal: true, Error: "Error al buscar la aplicación"})
+		return req, nil, false
+	}
+	if err == sql.ErrNoRows || client.Disabled {
+		oc.renderAuthorize(c, http.StatusBadRequest, authorizePage{Fatal: true, Error: "Aplicación desconocida"})
+		return req, nil, false
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		oc.renderAuthorize(c, http.StatusBadRequest, authorizePage{Fatal: true, Error: "La URI de redirección no está registrada para esta aplicación"})
+		return req, nil, false
+	}
+
+	if req.ResponseType != "code" {
+		oc.redirectAuthorize(c, req, url.Values{"error": {"unsupported_response_type"}})
+		return req, nil, false
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if !slices.Contains(scopes, models.ScopeOpenID) {
+		oc.redirectAuthorize(c, req, url.Values{"error": {"invalid_scope"}, "error_description": {"se requiere el scope openid"}})
+		return req, nil, false
+	}
+	for _, scope := range scopes {
+		if !client.HasScope(scope) {
+			oc.redirectAuthorize(c, req, url.Values{"error": {"invalid_scope"}, "error_description": {"scope no permitido: " + scope}})
+			return req, nil, false
+		}
+	}
+
+	// PKCE es obligatorio, también para los clientes confidenciales
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 {
+		oc.redirectAuthorize(c, req, url.Values{"error": {"invalid_request"}, "error_description": {"se requiere PKCE con code_challenge_method=S256"}})
+		return req, nil, false
+	}
+
+	return req, client, true
+}
+
+// renderAuthorize muestra la página de autorización. Se prohíbe incrustarla
+// en marcos para evitar clickjacking.
+func (oc *OAuthController) renderAuthorize(c *gin.Context, status int, page authorizePage) {
+	if !page.Fatal {
+		page.CSRFToken = oc.authorizeCSRFToken(oc.authorizeCSRFCookie(c), page.Request)
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+
+	if err := authorizeTemplate.Execute(c.Writer, page); err != nil {
+		log.Printf("Error al mostrar la página de autorización: %v", err)
+	}
+}
+
+// authorizeCSRFCookieName es la cookie que vincula el formulario de
+// autorización con el navegador al que se mostró
+const authorizeCSRFCookieName = "oidc_csrf"
+
+// authorizeCSRFCookie devuelve el valor aleatorio de la cookie CSRF del
+// navegador, creándola si todavía no la tiene
+func (oc *OAuthController) authorizeCSRFCookie(c *gin.Context) string {
+	if value, err := c.Cookie(authorizeCSRFCookieName); err == nil && len(value) == 43 {
+		return value
+	}
+
+	value, err := security.NewOpaqueToken(32)
+	if err != nil {
+		log.Printf("Error al generar la cookie CSRF: %v", err)
+		return ""
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(authorizeCSRFCookieName, value, 0, "/oauth/authorize", "", strings.HasPrefix(oc.Config.AppBaseURL, "https://"), true)
+	return value
+}
+
+// authorizeCSRFToken firma la cookie del navegador junto con los parámetros
+// de la solicitud, de modo que el token solo sirve para ese navegador y esa
+// solicitud de autorización
+func (oc *OAuthController) authorizeCSRFToken(cookie string, req models.AuthorizeRequest) string {
+	mac := hmac.New(sha256.New, oc.csrfKey)
+	for _, value := range []string{cookie, req.ClientID, req.RedirectURI, req.Scope, req.State, req.Nonce, req.CodeChallenge} {
+		mac.Write([]byte(value))
+		mac.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkAuthorizeCSRF verifica el token CSRF enviado con el formulario
+func (oc *OAuthController) checkAuthorizeCSRF(c *gin.Context, req models.AuthorizeRequest) bool {
+	cookie, err := c.Cookie(authorizeCSRFCookieName)
+	if err != nil || cookie == "" {
+		return false
+	}
+	expected := oc.authorizeCSRFToken(cookie, req)
+	return hmac.Equal([]byte(c.PostForm("csrf_token")), []byte(expected))
+}
+
+// redirectAuthorize vuelve a la URI de redirección (ya validada) con los
+// parámetros indicados, el state de la aplicación y el emisor (RFC 9207)
+func (oc *OAuthController) redirectAuthorize(c *gin.Context, req models.AuthorizeRequest, params url.Values) {
+	target, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		oc.renderAuthorize(c, http.StatusBadRequest, authorizePage{Fatal: true, Error: "URI de redirección inválida"})
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", oc.Config.AppBaseURL)
+	target.RawQuery = query.Encode()
+
+	// 303 hace que el navegador siga la redirección con GET también tras el POST del formulario
+	c.Redirect(http.StatusSeeOther, target.String())
+}
+
+// authorizationCode canjea un código de autorización por un token de acceso y
+// un id_token. El code_verifier debe corresponder al code_challenge (PKCE).
+func (oc *OAuthController) authorizationCode(c *gin.Context, req models.OAuthTokenRequest) {
+	if req.Code == "" || req.RedirectURI == "" || req.CodeVerifier == "" {
+		c.JSON(http.StatusBadRequest, models.OAuthError{Error: "invalid_request", ErrorDescription: "faltan code, redirect_uri o code_verifier"})
+		return
+	}
+
+	client, ok := oc.authenticateClient(c, req, true)
+	if !ok {
+		return
+	}
+
+	code, err := db.ConsumeAuthorizationCode(security.HashToken(req.Code))
+	if err != nil {
+		if err == db.ErrInvalidToken {
+			c.JSON(http.StatusBadRequest, models.OAuthError{Error: "invalid_grant", ErrorDescription: "código inválido o expirado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.OAuthError{Error: "server_error"})
+		}
+		return
+	}
+	if code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI || !verifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		c.JSON(http.StatusBadRequest, models.OAuthError{Error: "invalid_grant"})
+		return
+	}
+
+	// La cuenta pudo haberse deshabilitado desde que se emitió el código
+	user, err := oc.auth.Users.FindByID(code.UserID)
+	if err != nil && err != store.ErrUserNotFound {
+		c.JSON(http.StatusInternalServerError, models.OAuthError{Error: "server_error"})
+		return
+	}
+	if err == store.ErrUserNotFound || oc.auth.accountStatusError(user) != "" {
+		c.JSON(http.StatusBadRequest, models.OAuthError{Error: "invalid_grant"})
+		return
+	}
+
+	// El token lleva su propia sesión (sid), para que el usuario pueda cerrarla
+	// desde sus sesiones y se cierre con las demás al cambiar la contraseña
+	sessionID, err := security.NewRandomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.OAuthError{Error: "server_error"})
+		return
+	}
+	if err := ensureSession(c, sessionID, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.OAuthError{Error: "server_error"})
+		return
+	}
+
+	scopes := strings.Fields(code.Scope)
+	accessToken, _, err := middleware.GenerateScopedToken(user.ID, user.Username, user.Email, user.Role, client.ClientID, scopes, sessionID, oc.Config.AccessTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.OAuthError{Error: "server_error"})
+		return
+	}
+
+	claims := &middleware.IDTokenClaims{
+		Nonce:    code.Nonce,
+		AuthTime: jwt.NewNumericDate(code.AuthTime),
+	}
+	if slices.Contains(scopes, models.ScopeProfile) {
+		claims.PreferredUsername = user.Username
+	}
+	if slices.Contains(scopes, models.ScopeEmail) {
+		claims.Email = user.Email
+		claims.EmailVerified = &user.EmailVerified
+	}
+	idToken, err := middleware.GenerateIDToken(claims, oc.Config.AppBaseURL, strconv.Itoa(user.ID), client.ClientID, oc.Config.AccessTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.OAuthError{Error: "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(oc.Config.AccessTokenTTL.Seconds()),
+		Scope:       code.Scope,
+		IDToken:     idToken,
+	})
+}
+
+// verifyPKCE comprueba que BASE64URL(SHA256(code_verifier)) coincida con el code_challenge (RFC 7636)
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// UserInfo devuelve los claims del usuario autenticado según los scopes del token
+func (oc *OAuthController) UserInfo(c *gin.Context) {
+	user, err := oc.auth.Users.FindByID(c.GetInt("user_id"))
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			c.JSON(http.StatusNotFound, models.ResponseError{Error: "Usuario no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		}
+		return
+	}
+
+	scopes := c.GetStringSlice("scopes")
+	response := models.UserInfoResponse{Sub: strconv.Itoa(user.ID)}
+	if slices.Contains(scopes, models.ScopeProfile) {
+		response.PreferredUsername = user.Username
+	}
+	if slices.Contains(scopes, models.ScopeEmail) {
+		response.Email = user.Email
+		response.EmailVerified = &user.EmailVerified
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// OpenIDConfiguration publica el documento de descubrimiento de OpenID Connect
+func (oc *OAuthController) OpenIDConfiguration(c *gin.Context) {
+	issuer := oc.Config.AppBaseURL
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, models.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{oc.Config.JWTAlgorithm},
+		ScopesSupported:                   []string{models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		GrantTypesSupported:               []string{"authorization_code", "client_credentials"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "email", "email_verified"},
+	})
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"auth/config"
+	"auth/models"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// challengeFor calcula el code_challenge S256 de un code_verifier
+func challengeFor(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// Ejemplo del apéndice B de RFC 7636
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"ejemplo de RFC 7636", verifier, challenge, true},
+		{"verificador distinto", strings.Repeat("a", 43), challenge, false},
+		{"verificador vacío", "", challenge, false},
+		{"42 caracteres", strings.Repeat("a", 42), challengeFor(strings.Repeat("a", 42)), false},
+		{"43 caracteres", strings.Repeat("a", 43), challengeFor(strings.Repeat("a", 43)), true},
+		{"128 caracteres", strings.Repeat("a", 128), challengeFor(strings.Repeat("a", 128)), true},
+		{"129 caracteres", strings.Repeat("a", 129), challengeFor(strings.Repeat("a", 129)), false},
+		{"challenge con relleno", verifier, challenge + "=", false},
+		{"challenge en hexadecimal", verifier, "13d31e961a1ad8ec2f16b10c4c982e0876a878ad6df144566ee1894acb70f9c3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("verifyPKCE = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeCSRF(t *testing.T) {
+	oc := NewOAuthController(config.Config{OIDCCSRFSecret: "secreto"}, nil)
+	req := models.AuthorizeRequest{
+		ClientID:      "cliente",
+		RedirectURI:   "https://app.example.com/callback",
+		Scope:         "openid",
+		State:         "s1",
+		Nonce:         "n1",
+		CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+	}
+	const cookie = "cookie-del-navegador"
+	token := oc.authorizeCSRFToken(cookie, req)
+
+	otherState := req
+	otherState.State = "s2"
+	otherNonce := req
+	otherNonce.Nonce = "n2"
+	otherClient := req
+	otherClient.ClientID = "otro"
+
+	tests := []struct {
+		name   string
+		req    models.AuthorizeRequest
+		cookie string // Vacía: la solicitud no lleva la cookie
+		token  string
+		want   bool
+	}{
+		{"mismo navegador y solicitud", req, cookie, token, true},
+		{"sin cookie", req, "", token, false},
+		{"cookie de otro navegador", req, "otra-cookie", token, false},
+		{"sin token", req, cookie, "", false},
+		{"otro state", otherState, cookie, token, false},
+		{"otro nonce", otherNonce, cookie, token, false},
+		{"otro cliente", otherClient, cookie, token, false},
+		{"token de otra clave", req, cookie, NewOAuthController(config.Config{OIDCCSRFSecret: "otra"}, nil).authorizeCSRFToken(cookie, req), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestContext(http.MethodPost, "/oauth/authorize", "192.0.2.1")
+			c.Request.PostForm = url.Values{"csrf_token": {tt.token}}
+			if tt.cookie != "" {
+				c.Request.AddCookie(&http.Cookie{Name: authorizeCSRFCookieName, Value: tt.cookie})
+			}
+			if got := oc.checkAuthorizeCSRF(c, tt.req); got != tt.want {
+				t.Errorf("checkAuthorizeCSRF = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/mailer"
+	"auth/models"
+	"auth/security"
+	"auth/store"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForgotPassword envía un enlace de restablecimiento de contraseña.
+// Siempre responde lo mismo para no revelar qué correos están registrados.
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Correo electrónico inválido"})
+		return
+	}
+
+	response := models.MessageResponse{Message: "Si el correo está registrado, recibirás un enlace para restablecer tu contraseña"}
+
+	user, err := ac.Users.FindByEmail(req.Email)
+	if err != nil {
+		if err != store.ErrUserNotFound {
+			log.Printf("Error al buscar el usuario para restablecer la contraseña: %v", err)
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if user.Disabled {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	if err := ac.sendPasswordReset(user); err != nil {
+		log.Printf("Error al enviar el correo de restablecimiento al usuario %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// sendPasswordReset invalida los enlaces anteriores y envía uno nuevo
+func (ac *AuthController) sendPasswordReset(user models.User) error {
+	if err := db.InvalidateOneTimeTokens(user.ID, db.PurposePasswordReset); err != nil {
+		return err
+	}
+
+	token, err := security.NewOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(ac.Config.PasswordResetTTL)
+	if err := db.CreateOneTimeToken(user.ID, db.PurposePasswordReset, security.HashToken(token), "", expiresAt); err != nil {
+		return err
+	}
+
+	link := ac.Config.AppBaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	return ac.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Restablece tu contraseña",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nRecibimos una solicitud para restablecer tu contraseña. Usa este enlace antes de %s:\n\n%s\n\nSi no la solicitaste, ignora este correo.\n",
+			user.Username, expiresAt.Format(time.RFC1123), link,
+		),
+	})
+}
+
+// ResetPassword cambia la contraseña usando un token de restablecimiento
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos de restablecimiento inválidos"})
+		return
+	}
+
+	// Validar la nueva contraseña antes de consumir el token, para que pueda
+	// reintentarse con otra si la política la rechaza
+	pending, err := db.FindOneTimeToken(db.PurposePasswordReset, security.HashToken(req.Token))
+	if err != nil {
+		if err == db.ErrInvalidToken {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de restablecimiento inválido o expirado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+		}
+		return
+	}
+	user, err := ac.Users.FindByID(pending.UserID)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de restablecimiento inválido o expirado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al restablecer la contraseña"})
+		}
+		return
+	}
+	if !ac.checkPasswordPolicy(c, user, req.Password) {
+		return
+	}
+
+	// Encriptar la nueva contraseña
+	hashedPassword, err := ac.Passwords.Hash(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al procesar la contraseña"})
+		return
+	}
+
+	// Consumir el token antes de cambiar la contraseña, para que no pueda usarse dos veces
+	tx, err := db.Database.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al restablecer la contraseña"})
+		return
+	}
+	defer tx.Rollback()
+
+	token, err := db.ConsumeOneTimeToken(tx, db.PurposePasswordReset, security.HashToken(req.Token))
+	if err != nil {
+		if err == db.ErrInvalidToken {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de restablecimiento inválido o expirado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+		}
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al restablecer la contraseña"})
+		return
+	}
+
+	if err := ac.Users.UpdatePassword(token.UserID, hashedPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al restablecer la contraseña"})
+		return
+	}
+	ac.recordPasswordHistory(token.UserID, hashedPassword)
+
+	// Cerrar las sesiones existentes, que pudieron abrirse con la contraseña anterior
+	if err := revokeUserSessions(token.UserID, "", ac.Config.AccessTokenTTL); err != nil {
+		log.Printf("Error al revocar los tokens de renovación del usuario %d: %v", token.UserID, err)
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditPasswordReset, Outcome: models.AuditSuccess, ActorID: token.UserID, TargetID: token.UserID})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Contraseña restablecida correctamente"})
+}
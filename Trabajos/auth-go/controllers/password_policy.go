@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"auth/config"
+	"auth/db"
+	"auth/models"
+	"auth/security"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoadPasswordPolicy crea la política de contraseñas configurada e indexa el
+// archivo de contraseñas filtradas, si se indicó uno
+func LoadPasswordPolicy(cfg config.Config) (security.PasswordPolicy, error) {
+	policy := security.PasswordPolicy{
+		MinLength:        cfg.PasswordMinLength,
+		MaxLength:        cfg.PasswordMaxLength,
+		RequireUppercase: cfg.PasswordRequireUppercase,
+		RequireLowercase: cfg.PasswordRequireLowercase,
+		RequireDigit:     cfg.PasswordRequireDigit,
+		RequireSymbol:    cfg.PasswordRequireSymbol,
+		DisallowUserInfo: cfg.PasswordDisallowUserInfo,
+	}
+
+	if cfg.BreachedPasswordsFile != "" {
+		breached, err := security.LoadBreachedPasswords(cfg.BreachedPasswordsFile)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// checkPasswordPolicy valida una contraseña nueva para el usuario y responde
+// con las reglas incumplidas si no es válida. Para un usuario existente (con
+// ID) también se rechazan su contraseña actual y las del historial.
+func (ac *AuthController) checkPasswordPolicy(c *gin.Context, user models.User, password string) bool {
+	violations, err := ac.Policy.Check(password, user.Username, user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al validar la contraseña"})
+		return false
+	}
+
+	if user.ID != 0 {
+		reused, err := ac.isPasswordReused(user, password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al validar la contraseña"})
+			return false
+		}
+		if reused {
+			violations = append(violations, security.PolicyViolation{
+				Rule:    security.RuleHistory,
+				Message: "No debe coincidir con una contraseña usada recientemente",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, models.PasswordPolicyError{
+			Error:      "La contraseña no cumple la política de contraseñas",
+			Violations: violations,
+		})
+		return false
+	}
+	return true
+}
+
+// isPasswordReused indica si la contraseña coincide con la actual del usuario
+// o con alguna de las últimas PASSWORD_HISTORY
+func (ac *AuthController) isPasswordReused(user models.User, password string) (bool, error) {
+	if ac.Config.PasswordHistory == 0 {
+		return false, nil
+	}
+
+	hashes, err := db.RecentPasswordHashes(user.ID, ac.Config.PasswordHistory)
+	if err != nil {
+		return false, err
+	}
+	if user.Password != "" {
+		hashes = append(hashes, user.Password)
+	}
+
+	for _, hash := range hashes {
+		match, _, err := ac.Passwords.Verify(password, hash)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordPasswordHistory guarda el hash de la contraseña recién establecida en
+// el historial. Un fallo no deshace el cambio de contraseña.
+func (ac *AuthController) recordPasswordHistory(userID int, passwordHash string) {
+	if err := db.AddPasswordHistory(userID, passwordHash, ac.Config.PasswordHistory); err != nil {
+		log.Printf("Error al guardar el historial de contraseñas del usuario %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/models"
+	"database/sql"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListRoles lista los roles con sus permisos
+func (adc *AdminController) ListRoles(c *gin.Context) {
+	roles, err := db.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al listar los roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// CreateRole crea un rol con los permisos indicados
+func (adc *AdminController) CreateRole(c *gin.Context) {
+	var req models.CreateRoleRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil || !models.IsValidRoleName(req.Name) {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos del rol inválidos"})
+		return
+	}
+
+	if !checkGrantablePermissions(c, req.Permissions) {
+		return
+	}
+
+	exists, err := db.RoleExists(req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el rol"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, models.ResponseError{Error: "Ya existe un rol con ese nombre"})
+		return
+	}
+
+	id, err := db.CreateRole(req.Name, req.Description, req.Permissions)
+	if err != nil {
+		if err == db.ErrUnknownPermission {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Alguno de los permisos no existe"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al crear el rol"})
+		}
+		return
+	}
+
+	role, err := db.FindRole(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el rol"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditRoleUpdated, Outcome: models.AuditSuccess, Details: "creado: " + role.Name})
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRolePermissions reemplaza los permisos de un rol. Los permisos del rol
+// admin no pueden modificarse, para que siempre exista quien administre el servicio.
+func (adc *AdminController) UpdateRolePermissions(c *gin.Context) {
+	var req models.UpdateRolePermissionsRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos del rol inválidos"})
+		return
+	}
+
+	role, ok := adc.loadRole(c)
+	if !ok {
+		return
+	}
+	if role.Name == models.RoleAdmin {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "Los permisos del rol admin no pueden modificarse"})
+		return
+	}
+
+	// Nadie puede ampliar los permisos de su propio rol, dar a un rol permisos
+	// que no tiene ni quitarle los que no tiene
+	if !adc.checkNotOwnRole(c, role.Name) || !checkGrantablePermissions(c, role.Permissions) || !checkGrantablePermissions(c, req.Permissions) {
+		return
+	}
+
+	if err := db.UpdateRole(role.ID, req.Description, req.Permissions); err != nil {
+		if err == db.ErrUnknownPermission {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Alguno de los permisos no existe"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al actualizar el rol"})
+		}
+		return
+	}
+
+	role, err := db.FindRole(role.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el rol"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditRoleUpdated, Outcome: models.AuditSuccess, Details: "modificado: " + role.Name})
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole elimina un rol que no esté asignado a ningún usuario
+func (adc *AdminController) DeleteRole(c *gin.Context) {
+	role, ok := adc.loadRole(c)
+	if !ok {
+		return
+	}
+	if role.Builtin {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "Los roles incluidos no pueden eliminarse"})
+		return
+	}
+
+	users, err := adc.Users.CountByRole(role.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el rol"})
+		return
+	}
+	if users > 0 {
+		c.JSON(http.StatusConflict, models.ResponseError{Error: "El rol está asignado a usuarios"})
+		return
+	}
+
+	if err := db.DeleteRole(role); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al eliminar el rol"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditRoleUpdated, Outcome: models.AuditSuccess, Details: "eliminado: " + role.Name})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Rol eliminado correctamente"})
+}
+
+// ListPermissions lista los permisos existentes
+func (adc *AdminController) ListPermissions(c *gin.Context) {
+	permissions, err := db.ListPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al listar los permisos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// CreatePermission crea un permiso que luego puede asignarse a los roles
+func (adc *AdminController) CreatePermission(c *gin.Context) {
+	var req models.CreatePermissionRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil || !models.IsValidRBACName(req.Name) {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Datos del permiso inválidos"})
+		return
+	}
+
+	var exists int
+	if err := db.Database.QueryRow("SELECT COUNT(*) FROM permissions WHERE name = ?", req.Name).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el permiso"})
+		return
+	}
+	if exists > 0 {
+		c.JSON(http.StatusConflict, models.ResponseError{Error: "Ya existe un permiso con ese nombre"})
+		return
+	}
+
+	id, err := db.CreatePermission(req.Name, req.Description)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al crear el permiso"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditPermissionUpdated, Outcome: models.AuditSuccess, Details: "creado: " + req.Name})
+	c.JSON(http.StatusCreated, models.Permission{ID: id, Name: req.Name, Description: req.Description})
+}
+
+// DeletePermission elimina un permiso y lo quita de los roles que lo tenían
+func (adc *AdminController) DeletePermission(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	permission, err := db.FindPermission(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ResponseError{Error: "Permiso no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el permiso"})
+		}
+		return
+	}
+	if permission.Builtin {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "Los permisos incluidos no pueden eliminarse"})
+		return
+	}
+
+	if err := db.DeletePermission(id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al eliminar el permiso"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditPermissionUpdated, Outcome: models.AuditSuccess, Details: "eliminado: " + permission.Name})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Permiso eliminado correctamente"})
+}
+
+// loadRole obtiene el rol indicado por el parámetro :id, respondiendo si no existe
+func (adc *AdminController) loadRole(c *gin.Context) (*models.Role, bool) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return nil, false
+	}
+
+	role, err := db.FindRole(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ResponseError{Error: "Rol no encontrado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el rol"})
+		}
+		return nil, false
+	}
+	return role, true
+}
+
+// checkGrantableRole verifica que el rol exista y que quien hace la solicitud
+// tenga todos sus permisos, para que nadie pueda otorgar más de lo que tiene
+// ni actuar sobre usuarios con más permisos que él
+func checkGrantableRole(c *gin.Context, roleName string) bool {
+	role, err := db.FindRoleByName(roleName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Rol inválido"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el rol"})
+		}
+		return false
+	}
+
+	granted := c.GetStringSlice("permissions")
+	for _, permission := range role.Permissions {
+		if !slices.Contains(granted, permission) {
+			c.JSON(http.StatusForbidden, models.ResponseError{Error: "No puedes otorgar ni administrar un rol con permisos que no tienes"})
+			return false
+		}
+	}
+	return true
+}
+
+// checkGrantablePermissions verifica que quien hace la solicitud tenga todos
+// los permisos que se quieren asignar a un rol
+func checkGrantablePermissions(c *gin.Context, permissions []string) bool {
+	granted := c.GetStringSlice("permissions")
+	for _, permission := range permissions {
+		if !slices.Contains(granted, permission) {
+			c.JSON(http.StatusForbidden, models.ResponseError{Error: "No puedes asignar a un rol permisos que no tienes"})
+			return false
+		}
+	}
+	return true
+}
+
+// checkNotOwnRole responde con 403 si el rol es el de quien hace la solicitud,
+// según el token o el usuario guardado (el token puede ser anterior a un cambio de rol)
+func (adc *AdminController) checkNotOwnRole(c *gin.Context, roleName string) bool {
+	user, err := adc.Users.FindByID(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar el usuario"})
+		return false
+	}
+	if roleName == c.GetString("role") || roleName == user.Role {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: "No puedes modificar los permisos de tu propio rol"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/middleware"
+	"auth/models"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Longitud máxima guardada del User-Agent
+const maxUserAgentLength = 255
+
+// ListSessions lista las sesiones abiertas del usuario autenticado
+func (ac *AuthController) ListSessions(c *gin.Context) {
+	// Una sesión sin actividad durante la vigencia del token de renovación ya no puede usarse
+	since := time.Now().Add(-ac.Config.RefreshTokenTTL)
+	sessions, err := db.ListActiveSessions(c.GetInt("user_id"), since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al listar las sesiones"})
+		return
+	}
+
+	current := c.GetString("session_id")
+	response := make([]models.SessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = models.SessionResponse{Session: session, Current: session.ID == current}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession cierra una sesión del usuario autenticado
+func (ac *AuthController) RevokeSession(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	session, err := db.FindSession(c.Param("id"))
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al buscar la sesión"})
+		return
+	}
+	if err == sql.ErrNoRows || session.UserID != userID || session.RevokedAt.Valid {
+		c.JSON(http.StatusNotFound, models.ResponseError{Error: "Sesión no encontrada"})
+		return
+	}
+
+	if err := revokeSession(session.ID, userID, ac.Config.AccessTokenTTL); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al cerrar la sesión"})
+		return
+	}
+	audit(c, models.AuditEvent{EventType: models.AuditSessionRevoked, Outcome: models.AuditSuccess, TargetID: userID, Details: session.ID})
+
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Sesión cerrada correctamente"})
+}
+
+// ensureSession registra la sesión si todavía no existe. Las familias de
+// tokens de renovación creadas antes de registrar sesiones obtienen la suya
+// en la siguiente renovación.
+func ensureSession(c *gin.Context, sessionID string, userID int) error {
+	_, err := db.FindSession(sessionID)
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	userAgent := truncate(c.Request.UserAgent(), maxUserAgentLength)
+	return db.CreateSession(sessionID, userID, userAgent, c.ClientIP())
+}
+
+// revokeSession revoca la sesión, su familia de tokens de renovación y los
+// tokens de acceso ya emitidos para ella, que AuthMiddleware rechaza por su
+// claim sid hasta que expiren
+func revokeSession(sessionID string, userID int, accessTokenTTL time.Duration) error {
+	if _, err := db.RevokeSession(sessionID); err != nil {
+		return err
+	}
+	if err := db.RevokeRefreshFamily(sessionID); err != nil {
+		return err
+	}
+	return middleware.Revocations.Revoke(sessionID, userID, time.Now().Add(accessTokenTTL))
+}
+
+// revokeUserSessions cierra todas las sesiones del usuario salvo except
+// (vacío para cerrarlas todas)
+func revokeUserSessions(userID int, except string, accessTokenTTL time.Duration) error {
+	sessions, err := db.ListActiveSessions(userID, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == except {
+			continue
+		}
+		if err := revokeSession(session.ID, userID, accessTokenTTL); err != nil {
+			return err
+		}
+	}
+
+	// Las familias anteriores al registro de sesiones no tienen fila en sessions
+	if except == "" {
+		return db.RevokeUserRefreshTokens(userID)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"auth/models"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userResponse convierte un usuario en la información pública que se devuelve
+func userResponse(user models.User) models.UserResponse {
+	return models.UserResponse{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+		PendingEmail:  user.PendingEmail,
+	}
+}
+
+// maxUsernameLength es la longitud de la columna users.username
+const maxUsernameLength = 50
+
+// checkUsername responde con 400 si el nombre de usuario (ya normalizado) no
+// es válido. No puede contener '@' para no confundirse con un correo al
+// iniciar sesión.
+func checkUsername(c *gin.Context, username string) bool {
+	if username == "" || utf8.RuneCountInString(username) > maxUsernameLength || strings.Contains(username, "@") {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "El nombre de usuario no puede estar vacío, superar 50 caracteres ni contener @"})
+		return false
+	}
+	return true
+}
+
+// maxEmailLength es la longitud de la columna users.email
+const maxEmailLength = 100
+
+// validEmail indica si el correo (ya normalizado) es una dirección simple válida
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email && len(email) <= maxEmailLength
+}
+
+// checkAccountStatus responde con 403 si la cuenta no puede iniciar sesión
+func (ac *AuthController) checkAccountStatus(c *gin.Context, user models.User) bool {
+	if message := ac.accountStatusError(user); message != "" {
+		c.JSON(http.StatusForbidden, models.ResponseError{Error: message})
+		return false
+	}
+	return true
+}
+
+// accountStatusError devuelve el motivo por el que la cuenta no puede iniciar
+// sesión, o una cadena vacía si puede hacerlo
+func (ac *AuthController) accountStatusError(user models.User) string {
+	if user.Disabled {
+		return "La cuenta está deshabilitada"
+	}
+	if user.MustResetPassword {
+		return "Debe restablecer su contraseña antes de iniciar sesión; solicita un enlace de restablecimiento"
+	}
+	if ac.Config.RequireEmailVerification && !user.EmailVerified {
+		return "Debe verificar su correo electrónico antes de iniciar sesión"
+	}
+	return ""
+}
+
+// parseIDParam obtiene el parámetro :id de la ruta, respondiendo 400 si no es válido
+func parseIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "ID inválido"})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"auth/db"
+	"auth/mailer"
+	"auth/models"
+	"auth/security"
+	"auth/store"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyEmail marca el correo del usuario como verificado usando el token del enlace
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	tokenParam := c.Query("token")
+	if tokenParam == "" {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de verificación no proporcionado"})
+		return
+	}
+
+	// Consumir el token antes de verificar el correo, para que no pueda usarse dos veces
+	tx, err := db.Database.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el correo"})
+		return
+	}
+	defer tx.Rollback()
+
+	token, err := db.ConsumeOneTimeToken(tx, db.PurposeEmailVerification, security.HashToken(tokenParam))
+	if err != nil {
+		if err == db.ErrInvalidToken {
+			c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de verificación inválido o expirado"})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el token"})
+		}
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el correo"})
+		return
+	}
+
+	// El token guarda el correo al que se envió: si el usuario lo cambió desde entonces, ya no es válido
+	verified, err := ac.Users.MarkEmailVerified(token.UserID, token.Data)
+	if err != nil && err != store.ErrUserNotFound {
+		c.JSON(http.StatusInternalServerError, models.ResponseError{Error: "Error al verificar el correo"})
+		return
+	}
+	if !verified {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Token de verificación inválido o expirado"})
+		return
+	}
+
+	audit(c, models.AuditEvent{EventType: models.AuditEmailVerified, Outcome: models.AuditSuccess, ActorID: token.UserID, TargetID: token.UserID, Details: token.Data})
+	c.JSON(http.StatusOK, models.MessageResponse{Message: "Correo electrónico verificado correctamente"})
+}
+
+// ResendVerification vuelve a enviar el correo de verificación.
+// Siempre responde lo mismo para no revelar qué correos están registrados.
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	var req models.ResendVerificationRequest
+
+	// Validar que el cuerpo de la solicitud es correcto
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ResponseError{Error: "Correo electrónico inválido"})
+		return
+	}
+
+	response := models.MessageResponse{Message: "Si el correo está registrado y pendiente de verificación, recibirás un nuevo enlace"}
+
+	user, err := ac.Users.FindByEmail(req.Email)
+	if err != nil {
+		if err != store.ErrUserNotFound {
+			log.Printf("Error al buscar el usuario para reenviar la verificación: %v", err)
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if user.EmailVerified || user.Disabled {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	if err := ac.sendEmailVerification(user); err != nil {
+		log.Printf("Error al enviar el correo de verificación al usuario %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// sendEmailVerification invalida los enlaces anteriores y envía uno nuevo
+func (ac *AuthController) sendEmailVerification(user models.User) error {
+	if err := db.InvalidateOneTimeTokens(user.ID, db.PurposeEmailVerification); err != nil {
+		return err
+	}
+
+	token, err := security.NewOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(ac.Config.EmailVerificationTTL)
+	if err := db.CreateOneTimeToken(user.ID, db.PurposeEmailVerification, security.HashToken(token), user.Email, expiresAt); err != nil {
+		return err
+	}
+
+	link := ac.Config.AppBaseURL + "/api/auth/verify?token=" + url.QueryEscape(token)
+	return ac.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verifica tu correo electrónico",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nConfirma que esta dirección te pertenece abriendo el siguiente enlace antes de %s:\n\n%s\n\nSi no creaste una cuenta, ignora este correo.\n",
+			user.Username, expiresAt.Format(time.RFC1123), link,
+		),
+	})
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"auth/models"
+	"database/sql"
+	"time"
+)
+
+// apiKeyColumns son las columnas que se leen al cargar una clave de API
+const apiKeyColumns = "id, user_id, name, prefix, role, expires_at, last_used_at, revoked_at, created_at"
+
+// scanAPIKey lee una clave con las columnas de apiKeyColumns
+func scanAPIKey(row interface{ Scan(...any) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Role, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CreateAPIKey guarda una clave de API con su hash. expiresAt nulo indica que no expira.
+func CreateAPIKey(userID int, name, prefix, keyHash, role string, expiresAt sql.NullTime) (int, error) {
+	if expiresAt.Valid {
+		expiresAt.Time = expiresAt.Time.UTC()
+	}
+
+	result, err := Database.Exec(
+		"INSERT INTO api_keys (user_id, name, prefix, key_hash, role, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, name, prefix, keyHash, role, expiresAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// FindAPIKey busca una clave por su ID
+func FindAPIKey(id int) (*models.APIKey, error) {
+	return scanAPIKey(Database.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+}
+
+// FindAPIKeyByHash busca una clave por su hash
+func FindAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	return scanAPIKey(Database.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", keyHash))
+}
+
+// ListAPIKeys devuelve las claves de un usuario, de la más reciente a la más antigua
+func ListAPIKeys(userID int) ([]models.APIKey, error) {
+	rows, err := Database.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revoca una clave del usuario. Devuelve false si no existe,
+// pertenece a otro usuario o ya estaba revocada.
+func RevokeAPIKey(id, userID int) (bool, error) {
+	result, err := Database.Exec(
+		"UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), id, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// TouchAPIKey registra el último uso de la clave. Para no escribir en cada
+// solicitud, solo se actualiza si el último uso registrado es anterior a since.
+func TouchAPIKey(id int, now, since time.Time) error {
+	_, err := Database.Exec(
+		"UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		now.UTC(), id, since.UTC(),
+	)
+	return err
+}
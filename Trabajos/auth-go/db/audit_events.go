@@ -0,0 +1,137 @@
+package db
+
+import (
+	"auth/models"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+)
+
+// InsertAuditEvent agrega un evento al registro de auditoría
+func InsertAuditEvent(event models.AuditEvent) error {
+	var actorID, targetID sql.NullInt64
+	if event.ActorID > 0 {
+		actorID = sql.NullInt64{Int64: int64(event.ActorID), Valid: true}
+	}
+	if event.TargetID > 0 {
+		targetID = sql.NullInt64{Int64: int64(event.TargetID), Valid: true}
+	}
+
+	_, err := Database.Exec(
+		`INSERT INTO audit_events (event_type, outcome, actor_id, actor_name, target_id, ip, user_agent, details, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.EventType, event.Outcome, actorID, event.ActorName, targetID,
+		event.IP, event.UserAgent, event.Details, event.CreatedAt.UTC(),
+	)
+	return err
+}
+
+// ListAuditEvents devuelve una página de eventos que cumplen el filtro, del
+// más reciente al más antiguo, junto con el total de eventos que lo cumplen
+func ListAuditEvents(filter models.AuditFilter, limit, offset int) ([]models.AuditEvent, int, error) {
+	var conditions []string
+	var args []any
+
+	if filter.EventType != "" {
+		conditions = append(conditions, "event_type = ?")
+		args = append(args, filter.EventType)
+	}
+	if filter.Outcome != "" {
+		conditions = append(conditions, "outcome = ?")
+		args = append(args, filter.Outcome)
+	}
+	if filter.ActorID > 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.TargetID > 0 {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.IP != "" {
+		conditions = append(conditions, "ip = ?")
+		args = append(args, filter.IP)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := Database.QueryRow("SELECT COUNT(*) FROM audit_events"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	events, err := queryAuditEvents(where+" ORDER BY id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// ListUserAuditEvents devuelve todos los eventos realizados por el usuario o
+// que lo afectan, del más reciente al más antiguo
+func ListUserAuditEvents(userID int) ([]models.AuditEvent, error) {
+	return queryAuditEvents(" WHERE actor_id = ? OR target_id = ? ORDER BY id DESC", userID, userID)
+}
+
+// queryAuditEvents lee los eventos que cumplen la condición (y el orden) indicada en clauses
+func queryAuditEvents(clauses string, args ...any) ([]models.AuditEvent, error) {
+	rows, err := Database.Query(
+		`SELECT id, event_type, outcome, COALESCE(actor_id, 0), actor_name, COALESCE(target_id, 0), ip, user_agent, details, created_at
+			FROM audit_events`+clauses,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		if err := rows.Scan(&e.ID, &e.EventType, &e.Outcome, &e.ActorID, &e.ActorName, &e.TargetID, &e.IP, &e.UserAgent, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// PruneAuditEvents elimina los eventos anteriores a before
+func PruneAuditEvents(before time.Time) (int64, error) {
+	result, err := Database.Exec("DELETE FROM audit_events WHERE created_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// StartAuditRetention elimina periódicamente los eventos de auditoría con
+// una antigüedad mayor que retention
+func StartAuditRetention(retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			deleted, err := PruneAuditEvents(time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("Error al depurar el registro de auditoría: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Eventos de auditoría eliminados por retención: %d", deleted)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"auth/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+// insertTestAuditEvents agrega eventos con un día de diferencia entre cada
+// uno, el último de ellos hace una hora
+func insertTestAuditEvents(t *testing.T, now time.Time) {
+	t.Helper()
+
+	events := []models.AuditEvent{
+		{EventType: models.AuditLogin, Outcome: models.AuditFailure, ActorID: 1, IP: "10.0.0.1"},
+		{EventType: models.AuditLogin, Outcome: models.AuditSuccess, ActorID: 1, IP: "10.0.0.1"},
+		{EventType: models.AuditPasswordChanged, Outcome: models.AuditSuccess, ActorID: 1, TargetID: 1, IP: "10.0.0.2"},
+		{EventType: models.AuditLogin, Outcome: models.AuditSuccess, ActorID: 2, IP: "10.0.0.3"},
+		{EventType: models.AuditAPIKeyRevoked, Outcome: models.AuditSuccess, ActorID: 2, TargetID: 1, IP: "10.0.0.3"},
+	}
+	for i, event := range events {
+		event.CreatedAt = now.Add(-time.Hour - time.Duration(len(events)-1-i)*24*time.Hour)
+		if err := InsertAuditEvent(event); err != nil {
+			t.Fatalf("InsertAuditEvent: %v", err)
+		}
+	}
+}
+
+func TestListAuditEvents(t *testing.T) {
+	openTestDB(t)
+	now := time.Now()
+	insertTestAuditEvents(t, now)
+
+	tests := []struct {
+		name   string
+		filter models.AuditFilter
+		want   []int64
+	}{
+		{"sin filtro", models.AuditFilter{}, []int64{5, 4, 3, 2, 1}},
+		{"tipo", models.AuditFilter{EventType: models.AuditLogin}, []int64{4, 2, 1}},
+		{"tipo y resultado", models.AuditFilter{EventType: models.AuditLogin, Outcome: models.AuditFailure}, []int64{1}},
+		{"actor", models.AuditFilter{ActorID: 2}, []int64{5, 4}},
+		{"afectado", models.AuditFilter{TargetID: 1}, []int64{5, 3}},
+		{"IP", models.AuditFilter{IP: "10.0.0.1"}, []int64{2, 1}},
+		{"desde", models.AuditFilter{From: now.Add(-50 * time.Hour)}, []int64{5, 4, 3}},
+		{"hasta", models.AuditFilter{To: now.Add(-50 * time.Hour)}, []int64{2, 1}},
+		{"sin resultados", models.AuditFilter{ActorID: 3}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, total, err := ListAuditEvents(tt.filter, 10, 0)
+			if err != nil {
+				t.Fatalf("ListAuditEvents: %v", err)
+			}
+			var ids []int64
+			for _, event := range events {
+				ids = append(ids, event.ID)
+			}
+			if !slices.Equal(ids, tt.want) || total != len(tt.want) {
+				t.Errorf("eventos = %v (total %d), se esperaba %v", ids, total, tt.want)
+			}
+		})
+	}
+
+	// El total cuenta todos los eventos aunque la página sea menor
+	events, total, err := ListAuditEvents(models.AuditFilter{}, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != 3 || total != 5 {
+		t.Errorf("página = %+v (total %d), se esperaban los eventos 3 y 2 de 5", events, total)
+	}
+
+	// Los eventos realizados por el usuario o que lo afectan
+	userEvents, err := ListUserAuditEvents(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userEvents) != 4 || userEvents[0].ID != 5 {
+		t.Errorf("eventos del usuario 1 = %+v, se esperaban 5, 3, 2 y 1", userEvents)
+	}
+}
+
+func TestPruneAuditEvents(t *testing.T) {
+	openTestDB(t)
+	now := time.Now()
+	insertTestAuditEvents(t, now)
+
+	tests := []struct {
+		name      string
+		before    time.Time
+		want      int64
+		remaining int
+	}{
+		{"nada que eliminar", now.Add(-10 * 24 * time.Hour), 0, 5},
+		{"eventos de más de dos días", now.Add(-48 * time.Hour), 3, 2},
+		{"repetir no elimina más", now.Add(-48 * time.Hour), 0, 2},
+		{"todos", now, 2, 0},
+	}
+
+	for _, tt := range tests {
+		deleted, err := PruneAuditEvents(tt.before)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		_, total, err := ListAuditEvents(models.AuditFilter{}, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != tt.want || total != tt.remaining {
+			t.Errorf("%s: eliminados %d y quedan %d, se esperaban %d y %d", tt.name, deleted, total, tt.want, tt.remaining)
+		}
+	}
+}
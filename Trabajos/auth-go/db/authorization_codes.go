@@ -0,0 +1,56 @@
+package db
+
+import (
+	"auth/models"
+	"database/sql"
+	"time"
+)
+
+// CreateAuthorizationCode guarda el hash de un código de autorización
+func CreateAuthorizationCode(codeHash string, code models.AuthorizationCode) error {
+	_, err := Database.Exec(
+		`INSERT INTO oauth_authorization_codes
+			(code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		codeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope, code.Nonce, code.CodeChallenge,
+		code.AuthTime.UTC(), code.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+// ConsumeAuthorizationCode marca el código como usado y lo devuelve.
+// Devuelve ErrInvalidToken si no existe, ya fue usado o expiró.
+func ConsumeAuthorizationCode(codeHash string) (*models.AuthorizationCode, error) {
+	var code models.AuthorizationCode
+	err := Database.QueryRow(
+		`SELECT id, client_id, user_id, redirect_uri, scope, nonce, code_challenge, auth_time, expires_at
+			FROM oauth_authorization_codes WHERE code_hash = ? AND used_at IS NULL`,
+		codeHash,
+	).Scan(&code.ID, &code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope, &code.Nonce, &code.CodeChallenge, &code.AuthTime, &code.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !now.Before(code.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	// La condición sobre used_at evita que dos solicitudes concurrentes canjeen el mismo código
+	result, err := Database.Exec("UPDATE oauth_authorization_codes SET used_at = ? WHERE id = ? AND used_at IS NULL", now.UTC(), code.ID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	return &code, nil
+}
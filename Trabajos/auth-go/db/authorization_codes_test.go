@@ -0,0 +1,58 @@
+package db
+
+import (
+	"auth/models"
+	"testing"
+	"time"
+)
+
+func TestConsumeAuthorizationCode(t *testing.T) {
+	openTestDB(t)
+
+	now := time.Now()
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		consumed  int // Veces que se canjea antes del intento que se comprueba
+		wantErr   error
+	}{
+		{"vigente", now.Add(time.Minute), 0, nil},
+		{"reutilizado", now.Add(time.Minute), 1, ErrInvalidToken},
+		{"expirado", now.Add(-time.Second), 0, ErrInvalidToken},
+		{"expirado y reutilizado", now.Add(-time.Second), 1, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codeHash := "hash-" + tt.name
+			err := CreateAuthorizationCode(codeHash, models.AuthorizationCode{
+				ClientID:      "cliente",
+				UserID:        1,
+				RedirectURI:   "https://app.example.com/callback",
+				Scope:         "openid",
+				Nonce:         "n",
+				CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+				AuthTime:      now,
+				ExpiresAt:     tt.expiresAt,
+			})
+			if err != nil {
+				t.Fatalf("CreateAuthorizationCode: %v", err)
+			}
+			for range tt.consumed {
+				ConsumeAuthorizationCode(codeHash)
+			}
+
+			code, err := ConsumeAuthorizationCode(codeHash)
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, se esperaba %v", err, tt.wantErr)
+			}
+			if err == nil && (code.ClientID != "cliente" || code.UserID != 1 || code.Scope != "openid") {
+				t.Errorf("código = %+v", code)
+			}
+		})
+	}
+
+	if _, err := ConsumeAuthorizationCode("desconocido"); err != ErrInvalidToken {
+		t.Errorf("código desconocido: error = %v, se esperaba %v", err, ErrInvalidToken)
+	}
+}
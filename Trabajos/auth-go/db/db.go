@@ -6,26 +6,59 @@ import (
 	"fmt"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
 )
 
 // Database representa la conexión a la base de datos
 var Database *sql.DB
 
-// InitializeDB inicializa la conexión a la base de datos
-func InitializeDB(config config.Config) error {
-	// Formato de conexión: username:password@tcp(host:port)/dbname
-	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
-		config.DBUser,
-		config.DBPass,
-		config.DBHost,
-		config.DBPort,
-		config.DBName,
-	)
+// dialect es el dialecto SQL de la base de datos abierta ("mysql" o "sqlite")
+var dialect string
+
+// Dialect devuelve el dialecto SQL de la base de datos abierta, para las
+// sentencias que no se escriben igual en MySQL y SQLite
+func Dialect() string {
+	return dialect
+}
 
+// Connect abre la conexión a la base de datos indicada en DB_DRIVER y verifica que responda
+func Connect(config config.Config) error {
 	var err error
-	Database, err = sql.Open("mysql", connectionString)
-	if err != nil {
-		return fmt.Errorf("error conectando a la base de datos: %w", err)
+	switch config.DBDriver {
+	case "sqlite", "memory":
+		// Con memory los usuarios no están en la base de datos, por lo que no
+		// pueden comprobarse las claves foráneas que apuntan a ellos
+		path, foreignKeys := config.SQLitePath, 1
+		if config.DBDriver == "memory" {
+			path, foreignKeys = ":memory:", 0
+		}
+		dialect = "sqlite"
+		Database, err = sql.Open("sqlite", fmt.Sprintf(
+			"file:%s?_pragma=foreign_keys(%d)&_pragma=busy_timeout(5000)&_time_format=sqlite",
+			path, foreignKeys,
+		))
+		if err != nil {
+			return fmt.Errorf("error conectando a la base de datos: %w", err)
+		}
+		// SQLite admite un solo escritor, y cada conexión a :memory: es una base
+		// de datos distinta: usar una única conexión
+		Database.SetMaxOpenConns(1)
+
+	default:
+		// Formato de conexión: username:password@tcp(host:port)/dbname
+		connectionString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+			config.DBUser,
+			config.DBPass,
+			config.DBHost,
+			config.DBPort,
+			config.DBName,
+		)
+
+		dialect = "mysql"
+		Database, err = sql.Open("mysql", connectionString)
+		if err != nil {
+			return fmt.Errorf("error conectando a la base de datos: %w", err)
+		}
 	}
 
 	// Verificar la conexión
@@ -34,34 +67,35 @@ func InitializeDB(config config.Config) error {
 		return fmt.Errorf("error al hacer ping a la base de datos: %w", err)
 	}
 
-	// Crear la tabla de usuarios si no existe
-	err = createTables()
-	if err != nil {
-		return fmt.Errorf("error al crear tablas: %w", err)
-	}
-
 	return nil
 }
 
-// createTables crea las tablas necesarias si no existen
-func createTables() error {
-	// Definir sentencia SQL para crear la tabla de usuarios
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		username VARCHAR(50) NOT NULL UNIQUE,
-		email VARCHAR(100) NOT NULL UNIQUE,
-		password VARCHAR(255) NOT NULL,
-		role VARCHAR(20) NOT NULL DEFAULT 'user',
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
-	)
-	`
+// InitializeDB conecta con la base de datos y prepara el esquema. Con
+// DB_AUTO_MIGRATE aplica las migraciones pendientes; si no, exige que se
+// hayan aplicado antes con el subcomando migrate. Con DB_DRIVER=memory la
+// base de datos empieza vacía en cada inicio, así que siempre se migra.
+func InitializeDB(config config.Config) error {
+	if err := Connect(config); err != nil {
+		return err
+	}
 
-	// Ejecutar la sentencia SQL
-	_, err := Database.Exec(createTableSQL)
-	if err != nil {
-		return fmt.Errorf("error al crear tabla de usuarios: %w", err)
+	if config.AutoMigrate || config.DBDriver == "memory" {
+		if _, err := MigrateUp(); err != nil {
+			return fmt.Errorf("error al aplicar las migraciones: %w", err)
+		}
+	} else {
+		pending, err := PendingMigrations()
+		if err != nil {
+			return fmt.Errorf("error al verificar las migraciones: %w", err)
+		}
+		if pending > 0 {
+			return fmt.Errorf("hay %d migraciones pendientes: ejecuta el subcomando migrate", pending)
+		}
+	}
+
+	// Crear los roles y permisos incluidos en el servicio
+	if err := SeedRBAC(); err != nil {
+		return fmt.Errorf("error al crear roles y permisos: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"auth/config"
+	"testing"
+)
+
+// openTestDB abre una base de datos SQLite en memoria, como DB_DRIVER=memory,
+// con todas las migraciones aplicadas
+func openTestDB(t *testing.T) {
+	t.Helper()
+
+	if err := Connect(config.Config{DBDriver: "memory"}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { Database.Close() })
+
+	if _, err := MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"auth/models"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// IdentityCollision es un grupo de usuarios cuyos nombres de usuario o
+// correos coinciden una vez normalizados
+type IdentityCollision struct {
+	Field      string // "username" o "email"
+	Normalized string
+	UserIDs    []int
+	Values     []string // Valores guardados, en el orden de UserIDs
+}
+
+func (c IdentityCollision) String() string {
+	users := make([]string, len(c.UserIDs))
+	for i, id := range c.UserIDs {
+		users[i] = fmt.Sprintf("%d (%q)", id, c.Values[i])
+	}
+	return fmt.Sprintf("%s %q: usuarios %s", c.Field, c.Normalized, strings.Join(users, ", "))
+}
+
+// NormalizeIdentities guarda normalizados los nombres de usuario y correos de
+// todos los usuarios y devuelve cuántos valores cambió. Los usuarios que
+// colisionarían entre sí (los nombres sin distinguir mayúsculas, como la
+// intercalación de la columna) no se modifican: se devuelven para resolverlos
+// a mano, por ejemplo cambiando el nombre o el correo de uno de ellos.
+func NormalizeIdentities() (int, []IdentityCollision, error) {
+	type identity struct {
+		id              int
+		username, email string
+	}
+
+	// Leer todos los usuarios antes de modificarlos: SQLite usa una sola conexión
+	rows, err := Database.Query("SELECT id, username, email FROM users ORDER BY id")
+	if err != nil {
+		return 0, nil, err
+	}
+	var users []identity
+	for rows.Next() {
+		var user identity
+		if err := rows.Scan(&user.id, &user.username, &user.email); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	fields := []struct {
+		column    string
+		value     func(identity) string
+		normalize func(string) string
+		key       func(string) string
+	}{
+		{"username", func(u identity) string { return u.username }, models.NormalizeUsername, strings.ToLower},
+		{"email", func(u identity) string { return u.email }, models.NormalizeEmail, func(s string) string { return s }},
+	}
+
+	changed := 0
+	var collisions []IdentityCollision
+	for _, field := range fields {
+		groups := map[string][]identity{}
+		for _, user := range users {
+			key := field.key(field.normalize(field.value(user)))
+			groups[key] = append(groups[key], user)
+		}
+
+		for key, group := range groups {
+			if len(group) > 1 {
+				collision := IdentityCollision{Field: field.column, Normalized: key}
+				for _, user := range group {
+					collision.UserIDs = append(collision.UserIDs, user.id)
+					collision.Values = append(collision.Values, field.value(user))
+				}
+				collisions = append(collisions, collision)
+				continue
+			}
+
+			user := group[0]
+			normalized := field.normalize(field.value(user))
+			if normalized == field.value(user) {
+				continue
+			}
+			if _, err := Database.Exec("UPDATE users SET "+field.column+" = ? WHERE id = ?", normalized, user.id); err != nil {
+				return changed, collisions, fmt.Errorf("error al normalizar %s del usuario %d: %w", field.column, user.id, err)
+			}
+			changed++
+		}
+	}
+
+	sort.Slice(collisions, func(i, j int) bool {
+		if collisions[i].Field != collisions[j].Field {
+			return collisions[i].Field > collisions[j].Field
+		}
+		return collisions[i].Normalized < collisions[j].Normalized
+	})
+	return changed, collisions, nil
+}
+
+// normalizeIdentitiesMigration es el paso en Go de la migración
+// 0005_normalize_identities. Las colisiones no la hacen fallar, para no
+// impedir que el servicio inicie: se informan en el log y pueden volver a
+// revisarse con "migrate identities".
+func normalizeIdentitiesMigration() error {
+	changed, collisions, err := NormalizeIdentities()
+	if err != nil {
+		return err
+	}
+	log.Printf("Identidades normalizadas: %d valores actualizados", changed)
+	for _, collision := range collisions {
+		log.Printf("Advertencia: colisión de identidades sin normalizar, %s", collision)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeIdentities(t *testing.T) {
+	openTestDB(t)
+
+	// Usuarios guardados antes de la normalización, sin pasar por el almacén
+	users := []struct {
+		username string
+		email    string
+		// Valores esperados tras normalizar
+		wantUsername string
+		wantEmail    string
+	}{
+		{"Ｊuan", "juan@example.com", "Juan", "juan@example.com"},
+		{"Ana", "ana@example.com", "Ana", "ana@example.com"},
+		{"ａｎａ", "ana2@example.com", "ａｎａ", "ana2@example.com"},
+		{"pepe", "Pepe@Example.com ", "pepe", "Pepe@Example.com "},
+		{"pepe2", "pepe@example.com", "pepe2", "pepe@example.com"},
+		{"luis", " LUIS@EXAMPLE.COM", "luis", "luis@example.com"},
+		{"Jose\u0301", "jose@example.com", "José", "jose@example.com"},
+	}
+	for _, user := range users {
+		if _, err := Database.Exec("INSERT INTO users (username, email, password, role) VALUES (?, ?, 'hash', 'user')", user.username, user.email); err != nil {
+			t.Fatalf("insertar %q: %v", user.username, err)
+		}
+	}
+
+	wantCollisions := []IdentityCollision{
+		{Field: "username", Normalized: "ana", UserIDs: []int{2, 3}, Values: []string{"Ana", "ａｎａ"}},
+		{Field: "email", Normalized: "pepe@example.com", UserIDs: []int{4, 5}, Values: []string{"Pepe@Example.com ", "pepe@example.com"}},
+	}
+
+	// La segunda ejecución no cambia nada e informa las mismas colisiones
+	for run, wantChanged := range []int{3, 0} {
+		changed, collisions, err := NormalizeIdentities()
+		if err != nil {
+			t.Fatalf("ejecución %d: %v", run+1, err)
+		}
+		if changed != wantChanged {
+			t.Errorf("ejecución %d: %d valores cambiados, se esperaban %d", run+1, changed, wantChanged)
+		}
+		if len(collisions) != len(wantCollisions) {
+			t.Fatalf("ejecución %d: colisiones = %v", run+1, collisions)
+		}
+		for i, want := range wantCollisions {
+			got := collisions[i]
+			if got.Field != want.Field || got.Normalized != want.Normalized || !slices.Equal(got.UserIDs, want.UserIDs) || !slices.Equal(got.Values, want.Values) {
+				t.Errorf("ejecución %d: colisión %d = %+v, se esperaba %+v", run+1, i, got, want)
+			}
+		}
+	}
+
+	for i, user := range users {
+		var username, email string
+		if err := Database.QueryRow("SELECT username, email FROM users WHERE id = ?", i+1).Scan(&username, &email); err != nil {
+			t.Fatal(err)
+		}
+		if username != user.wantUsername || email != user.wantEmail {
+			t.Errorf("usuario %d = (%q, %q), se esperaba (%q, %q)", i+1, username, email, user.wantUsername, user.wantEmail)
+		}
+	}
+}
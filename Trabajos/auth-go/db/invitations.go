@@ -0,0 +1,132 @@
+package db
+
+import (
+	"auth/models"
+	"database/sql"
+	"time"
+)
+
+// invitationColumns son las columnas que se leen al cargar una invitación
+const invitationColumns = "id, role, COALESCE(email, ''), COALESCE(created_by, 0), expires_at, used_at, COALESCE(used_by, 0), created_at"
+
+// scanInvitation lee una invitación con las columnas de invitationColumns
+func scanInvitation(row interface{ Scan(...any) error }) (*models.Invitation, error) {
+	var inv models.Invitation
+	err := row.Scan(&inv.ID, &inv.Role, &inv.Email, &inv.CreatedBy, &inv.ExpiresAt, &inv.UsedAt, &inv.UsedBy, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// CreateInvitation guarda una invitación con el hash de su código.
+// createdBy es 0 para las invitaciones creadas por el propio servicio.
+func CreateInvitation(codeHash, role, email string, createdBy int, expiresAt time.Time) (int, error) {
+	var emailValue sql.NullString
+	if email != "" {
+		emailValue = sql.NullString{String: email, Valid: true}
+	}
+	var createdByValue sql.NullInt64
+	if createdBy > 0 {
+		createdByValue = sql.NullInt64{Int64: int64(createdBy), Valid: true}
+	}
+
+	result, err := Database.Exec(
+		"INSERT INTO invitations (code_hash, role, email, created_by, expires_at) VALUES (?, ?, ?, ?, ?)",
+		codeHash, role, emailValue, createdByValue, expiresAt.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// FindInvitation busca una invitación por su ID
+func FindInvitation(id int) (*models.Invitation, error) {
+	return scanInvitation(Database.QueryRow("SELECT "+invitationColumns+" FROM invitations WHERE id = ?", id))
+}
+
+// FindInvitationByCode busca una invitación por el hash de su código
+func FindInvitationByCode(codeHash string) (*models.Invitation, error) {
+	return scanInvitation(Database.QueryRow("SELECT "+invitationColumns+" FROM invitations WHERE code_hash = ?", codeHash))
+}
+
+// ListInvitations devuelve todas las invitaciones, de la más reciente a la más antigua
+func ListInvitations() ([]models.Invitation, error) {
+	rows, err := Database.Query("SELECT " + invitationColumns + " FROM invitations ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+// ClaimInvitation marca la invitación como usada por el usuario. Devuelve
+// false si ya fue usada o expiró, incluso por una solicitud concurrente.
+func ClaimInvitation(id, userID int) (bool, error) {
+	now := time.Now().UTC()
+	result, err := Database.Exec(
+		"UPDATE invitations SET used_at = ?, used_by = ? WHERE id = ? AND used_at IS NULL AND expires_at > ?",
+		now, userID, id, now,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// bootstrapInvitationCondition identifica las invitaciones de administrador
+// sin usar creadas por el propio servicio
+const bootstrapInvitationCondition = "role = ? AND created_by IS NULL AND email IS NULL AND used_at IS NULL"
+
+// CountUsableBootstrapInvitations cuenta las invitaciones de administrador
+// sin usar creadas por el propio servicio que todavía no han expirado
+func CountUsableBootstrapInvitations() (int, error) {
+	var count int
+	err := Database.QueryRow(
+		"SELECT COUNT(*) FROM invitations WHERE "+bootstrapInvitationCondition+" AND expires_at > ?",
+		models.RoleAdmin, time.Now().UTC(),
+	).Scan(&count)
+	return count, err
+}
+
+// DeleteExpiredBootstrapInvitations elimina las invitaciones de administrador
+// sin usar creadas por el propio servicio que ya expiraron y devuelve cuántas había
+func DeleteExpiredBootstrapInvitations() (int64, error) {
+	result, err := Database.Exec(
+		"DELETE FROM invitations WHERE "+bootstrapInvitationCondition+" AND expires_at <= ?",
+		models.RoleAdmin, time.Now().UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteInvitation elimina una invitación. Devuelve false si no existía.
+func DeleteInvitation(id int) (bool, error) {
+	result, err := Database.Exec("DELETE FROM invitations WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Ámbitos en los que se cuentan los intentos fallidos de inicio de sesión
+const (
+	LoginScopeUser = "user"
+	LoginScopeIP   = "ip"
+)
+
+// GetLoginLock devuelve hasta cuándo está bloqueado el identificador (cero si no lo está)
+func GetLoginLock(scope, identifier string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := Database.QueryRow(
+		"SELECT locked_until FROM login_attempts WHERE scope = ? AND identifier = ?",
+		scope, identifier,
+	).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+// RecordLoginFailure suma un intento fallido y devuelve el total acumulado.
+// Los fallos anteriores a resetBefore se descartan y el conteo empieza de nuevo.
+func RecordLoginFailure(scope, identifier string, resetBefore time.Time) (int, error) {
+	now := time.Now().UTC()
+
+	update := func() (int64, error) {
+		result, err := Database.Exec(
+			`UPDATE login_attempts
+			SET failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END, last_failure_at = ?
+			WHERE scope = ? AND identifier = ?`,
+			resetBefore.UTC(), now, scope, identifier,
+		)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}
+
+	rows, err := update()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		_, err := Database.Exec(
+			"INSERT INTO login_attempts (scope, identifier, failures, last_failure_at) VALUES (?, ?, 1, ?)",
+			scope, identifier, now,
+		)
+		// Si otra solicitud insertó la fila al mismo tiempo, sumar sobre ella
+		if err != nil {
+			if _, err := update(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	var failures int
+	err = Database.QueryRow(
+		"SELECT failures FROM login_attempts WHERE scope = ? AND identifier = ?",
+		scope, identifier,
+	).Scan(&failures)
+	return failures, err
+}
+
+// LockLogin bloquea el identificador hasta la fecha indicada
+func LockLogin(scope, identifier string, until time.Time) error {
+	_, err := Database.Exec(
+		"UPDATE login_attempts SET locked_until = ? WHERE scope = ? AND identifier = ?",
+		until.UTC(), scope, identifier,
+	)
+	return err
+}
+
+// ClearLoginFailures elimina los intentos fallidos y el bloqueo del identificador
+func ClearLoginFailures(scope, identifier string) error {
+	_, err := Database.Exec("DELETE FROM login_attempts WHERE scope = ? AND identifier = ?", scope, identifier)
+	return err
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"time"
+)
+
+// ReplaceRecoveryCodes reemplaza los códigos de recuperación del usuario
+func ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := Database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRecoveryCodes elimina los códigos de recuperación del usuario
+func DeleteRecoveryCodes(userID int) error {
+	_, err := Database.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	return err
+}
+
+// UseRecoveryCode marca como usado un código de recuperación. Devuelve false
+// si el código no existe o ya se usó.
+func UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	result, err := Database.Exec(
+		"UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
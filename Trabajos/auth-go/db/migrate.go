@@ -0,0 +1,444 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Las migraciones se incluyen en el binario, en un directorio por dialecto.
+// Cada versión tiene un archivo NNNN_nombre.up.sql que la aplica y un
+// NNNN_nombre.down.sql que la revierte, con el mismo número en ambos dialectos.
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// Migration es una versión del esquema de la base de datos
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// migrationHooks son pasos en Go que se ejecutan al aplicar una migración,
+// después de sus sentencias, para cambios que no pueden expresarse en SQL
+var migrationHooks = map[int]func() error{
+	5: normalizeIdentitiesMigration,
+}
+
+// MigrationStatus indica si una migración está aplicada y cuándo se aplicó
+type MigrationStatus struct {
+	Migration
+	AppliedAt sql.NullTime
+}
+
+// Bloqueo de las migraciones: evita que dos réplicas migren a la vez. Si el
+// proceso que lo tiene termina sin liberarlo, expira tras migrationLockTTL.
+const (
+	migrationLockTTL  = 10 * time.Minute
+	migrationLockWait = 2 * time.Minute
+)
+
+// loadMigrations lee las migraciones del dialecto de la base de datos, ordenadas por versión
+func loadMigrations() ([]Migration, error) {
+	dir := "migrations/" + dialect + "/"
+	files, err := fs.Glob(migrationFiles, dir+"*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		base := strings.TrimPrefix(file, dir)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction, base = "up", strings.TrimSuffix(base, ".up.sql")
+		case strings.HasSuffix(base, ".down.sql"):
+			direction, base = "down", strings.TrimSuffix(base, ".down.sql")
+		default:
+			return nil, fmt.Errorf("nombre de migración inválido: %s", file)
+		}
+
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("nombre de migración inválido: %s", file)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("la versión %d tiene dos nombres: %s y %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("la migración %d debe tener archivos .up.sql y .down.sql", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// splitStatements separa un archivo de migración en sentencias. Las sentencias
+// terminan con ';' al final de una línea y se ignoran las líneas de comentario.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
+
+// ensureMigrationTables crea las tablas de control de las migraciones
+func ensureMigrationTables() error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			id INT PRIMARY KEY,
+			locked_by VARCHAR(255) NOT NULL DEFAULT '',
+			locked_until DATETIME NULL
+		)`,
+	}
+	for _, statement := range statements {
+		if _, err := Database.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	// La fila del bloqueo puede haberla creado otra réplica al mismo tiempo
+	var count int
+	if err := Database.QueryRow("SELECT COUNT(*) FROM schema_migrations_lock WHERE id = 1").Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		if _, err := Database.Exec("INSERT INTO schema_migrations_lock (id) VALUES (1)"); err != nil {
+			if err := Database.QueryRow("SELECT COUNT(*) FROM schema_migrations_lock WHERE id = 1").Scan(&count); err != nil || count == 0 {
+				return fmt.Errorf("error al crear el bloqueo de migraciones: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// acquireMigrationLock espera hasta obtener el bloqueo de las migraciones y
+// devuelve la función que lo libera
+func acquireMigrationLock() (func(), error) {
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), time.Now().UnixNano())
+	deadline := time.Now().Add(migrationLockWait)
+
+	for {
+		now := time.Now().UTC()
+		result, err := Database.Exec(
+			"UPDATE schema_migrations_lock SET locked_by = ?, locked_until = ? WHERE id = 1 AND (locked_until IS NULL OR locked_until < ?)",
+			owner, now.Add(migrationLockTTL), now,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if rows, err := result.RowsAffected(); err == nil && rows == 1 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("otro proceso está aplicando migraciones")
+		}
+		time.Sleep(time.Second)
+	}
+
+	release := func() {
+		_, err := Database.Exec(
+			"UPDATE schema_migrations_lock SET locked_by = '', locked_until = NULL WHERE id = 1 AND locked_by = ?",
+			owner,
+		)
+		if err != nil {
+			log.Printf("Error al liberar el bloqueo de migraciones: %v", err)
+		}
+	}
+	return release, nil
+}
+
+// appliedMigrations devuelve las versiones aplicadas con su fecha
+func appliedMigrations() (map[int]time.Time, error) {
+	rows, err := Database.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// withMigrationLock prepara las tablas de control y ejecuta fn con el bloqueo tomado
+func withMigrationLock(fn func(migrations []Migration, applied map[int]time.Time) error) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := ensureMigrationTables(); err != nil {
+		return fmt.Errorf("error al crear las tablas de migraciones: %w", err)
+	}
+
+	release, err := acquireMigrationLock()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Leer las versiones aplicadas después de obtener el bloqueo, por si otra
+	// réplica acaba de migrar
+	applied, err := appliedMigrations()
+	if err != nil {
+		return fmt.Errorf("error al leer las migraciones aplicadas: %w", err)
+	}
+
+	return fn(migrations, applied)
+}
+
+// MigrateUp aplica las migraciones pendientes en orden y devuelve cuántas aplicó
+func MigrateUp() (int, error) {
+	count := 0
+	err := withMigrationLock(func(migrations []Migration, applied map[int]time.Time) error {
+		// Bases de datos creadas antes de las migraciones con una versión
+		// antigua de createTables: agregar las columnas que les falten
+		if len(applied) == 0 && dialect == "mysql" {
+			if err := upgradeLegacySchema(); err != nil {
+				return fmt.Errorf("error al actualizar el esquema existente: %w", err)
+			}
+		}
+
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := runMigration(migration.Version, migration.Name, migration.Up, true); err != nil {
+				return err
+			}
+			log.Printf("Migración aplicada: %04d_%s", migration.Version, migration.Name)
+			count++
+		}
+
+		// Versiones aplicadas por un binario más nuevo que este
+		known := map[int]bool{}
+		for _, migration := range migrations {
+			known[migration.Version] = true
+		}
+		for version := range applied {
+			if !known[version] {
+				log.Printf("Advertencia: la base de datos tiene aplicada la migración %d, desconocida para esta versión del servicio", version)
+			}
+		}
+
+		return nil
+	})
+	return count, err
+}
+
+// MigrateDown revierte las últimas steps migraciones aplicadas
+func MigrateDown(steps int) (int, error) {
+	count := 0
+	err := withMigrationLock(func(migrations []Migration, applied map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := runMigration(migration.Version, migration.Name, migration.Down, false); err != nil {
+				return err
+			}
+			log.Printf("Migración revertida: %04d_%s", migration.Version, migration.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// runMigration ejecuta las sentencias de una migración y registra el cambio
+// de versión. MySQL confirma implícitamente las sentencias DDL, por lo que si
+// una sentencia falla las anteriores quedan aplicadas y hay que corregir el
+// esquema a mano antes de reintentar.
+func runMigration(version int, name, script string, up bool) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := Database.Exec(statement); err != nil {
+			return fmt.Errorf("error en la migración %04d_%s: %w", version, name, err)
+		}
+	}
+
+	if hook := migrationHooks[version]; up && hook != nil {
+		if err := hook(); err != nil {
+			return fmt.Errorf("error en la migración %04d_%s: %w", version, name, err)
+		}
+	}
+
+	var err error
+	if up {
+		_, err = Database.Exec(
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			version, name, time.Now().UTC(),
+		)
+	} else {
+		_, err = Database.Exec("DELETE FROM schema_migrations WHERE version = ?", version)
+	}
+	if err != nil {
+		return fmt.Errorf("error al registrar la migración %04d_%s: %w", version, name, err)
+	}
+	return nil
+}
+
+// MigrationsStatus devuelve todas las migraciones conocidas indicando cuáles están aplicadas
+func MigrationsStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationTables(); err != nil {
+		return nil, fmt.Errorf("error al crear las tablas de migraciones: %w", err)
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer las migraciones aplicadas: %w", err)
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		status[i].Migration = migration
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status[i].AppliedAt = sql.NullTime{Time: appliedAt, Valid: true}
+		}
+	}
+	return status, nil
+}
+
+// PendingMigrations devuelve cuántas migraciones faltan por aplicar
+func PendingMigrations() (int, error) {
+	status, err := MigrationsStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, migration := range status {
+		if !migration.AppliedAt.Valid {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// upgradeLegacySchema agrega a una base de datos creada antes de las
+// migraciones las columnas que createTables no agregaba a tablas existentes.
+// En una base de datos vacía no hace nada.
+func upgradeLegacySchema() error {
+	var tables int
+	err := Database.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users'",
+	).Scan(&tables)
+	if err != nil || tables == 0 {
+		return err
+	}
+
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"users", "disabled", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"users", "must_reset_password", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"users", "email_verified", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"users", "totp_secret", "VARCHAR(64) NULL"},
+		{"users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"users", "totp_last_step", "BIGINT NOT NULL DEFAULT 0"},
+		{"oauth_clients", "redirect_uris", "VARCHAR(2000) NOT NULL DEFAULT ''"},
+		{"oauth_clients", "public", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	}
+
+	for _, col := range columns {
+		if err := addColumnIfMissing(col.table, col.column, col.definition); err != nil {
+			return fmt.Errorf("error al agregar columna %s.%s: %w", col.table, col.column, err)
+		}
+	}
+
+	return nil
+}
+
+// addColumnIfMissing agrega una columna a una tabla si la tabla existe y todavía no tiene la columna
+func addColumnIfMissing(table, column, definition string) error {
+	var tables, columns int
+	err := Database.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		table,
+	).Scan(&tables)
+	if err != nil || tables == 0 {
+		return err
+	}
+
+	err = Database.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		table, column,
+	).Scan(&columns)
+	if err != nil {
+		return err
+	}
+	if columns > 0 {
+		return nil
+	}
+
+	_, err = Database.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
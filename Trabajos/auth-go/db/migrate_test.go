@@ -0,0 +1,105 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"vacío", "", nil},
+		{"solo comentarios", "-- comentario\n\n  -- otro\n", nil},
+		{"una sentencia", "CREATE TABLE a (id INT);\n", []string{"CREATE TABLE a (id INT)"}},
+		{"varias líneas", "CREATE TABLE a (\n  id INT\n);\nDROP TABLE b;", []string{"CREATE TABLE a (\n  id INT\n)", "DROP TABLE b"}},
+		{"punto y coma dentro de la línea", "INSERT INTO a VALUES ('x;y');", []string{"INSERT INTO a VALUES ('x;y')"}},
+		{"sin punto y coma final", "DROP TABLE a;\nDROP TABLE b", []string{"DROP TABLE a", "DROP TABLE b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !slices.Equal(got, tt.want) {
+				t.Errorf("splitStatements = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Los dos dialectos deben tener las mismas versiones, cada una con up y down
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	previous := dialect
+	t.Cleanup(func() { dialect = previous })
+
+	versions := map[string][]string{}
+	for _, d := range []string{"sqlite", "mysql"} {
+		dialect = d
+		migrations, err := loadMigrations()
+		if err != nil {
+			t.Fatalf("%s: %v", d, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("%s: no hay migraciones", d)
+		}
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Errorf("%s: la migración %d tiene la versión %d", d, i+1, migration.Version)
+			}
+			versions[d] = append(versions[d], migration.Name)
+		}
+	}
+
+	if !slices.Equal(versions["sqlite"], versions["mysql"]) {
+		t.Errorf("sqlite = %v, mysql = %v", versions["sqlite"], versions["mysql"])
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	openTestDB(t)
+
+	all, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ya aplicadas: MigrateUp no hace nada
+	if count, err := MigrateUp(); err != nil || count != 0 {
+		t.Fatalf("MigrateUp = %d, %v; se esperaba 0", count, err)
+	}
+
+	steps := []struct {
+		name        string
+		run         func() (int, error)
+		wantCount   int
+		wantPending int
+	}{
+		{"revertir la última", func() (int, error) { return MigrateDown(1) }, 1, 1},
+		{"revertir todas", func() (int, error) { return MigrateDown(len(all) + 1) }, len(all) - 1, len(all)},
+		{"revertir sin migraciones aplicadas", func() (int, error) { return MigrateDown(1) }, 0, len(all)},
+		{"aplicar todas", MigrateUp, len(all), 0},
+	}
+
+	for _, step := range steps {
+		count, err := step.run()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if count != step.wantCount {
+			t.Errorf("%s: %d migraciones, se esperaban %d", step.name, count, step.wantCount)
+		}
+		pending, err := PendingMigrations()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if pending != step.wantPending {
+			t.Errorf("%s: %d pendientes, se esperaban %d", step.name, pending, step.wantPending)
+		}
+	}
+
+	// El esquema vuelve a estar completo
+	if _, err := Database.Exec("SELECT id, pending_email FROM users"); err != nil {
+		t.Errorf("tabla users tras volver a migrar: %v", err)
+	}
+}
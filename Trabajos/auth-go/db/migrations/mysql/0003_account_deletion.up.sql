@@ -0,0 +1,4 @@
+-- Eliminación de cuentas con periodo de gracia: la cuenta se elimina
+-- definitivamente a partir de delete_after, salvo que el usuario inicie sesión antes.
+
+ALTER TABLE users ADD COLUMN delete_after DATETIME NULL;
@@ -0,0 +1,3 @@
+-- Correo nuevo solicitado por el usuario, pendiente de confirmar desde esa dirección.
+
+ALTER TABLE users ADD COLUMN pending_email VARCHAR(100) NULL;
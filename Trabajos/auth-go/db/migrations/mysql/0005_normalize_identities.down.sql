@@ -0,0 +1,2 @@
+-- No se pueden recuperar las formas anteriores a la normalización; revertir
+-- esta versión solo la quita de schema_migrations.
@@ -0,0 +1,4 @@
+-- Normalización de nombres de usuario (NFKC) y correos (minúsculas y sin
+-- espacios en los extremos). SQL no puede aplicar NFKC, por lo que la hace
+-- normalizeIdentitiesMigration (db/identities.go) después de este archivo.
+-- Los usuarios que colisionarían entre sí no se modifican y se informan en el log.
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"auth/models"
+	"strings"
+)
+
+// oauthClientColumns son las columnas que se leen al cargar un cliente OAuth
+const oauthClientColumns = "id, client_id, secret_hash, name, scopes, redirect_uris, public, disabled, COALESCE(created_by, 0), created_at"
+
+// scanOAuthClient lee un cliente con las columnas de oauthClientColumns
+func scanOAuthClient(row interface{ Scan(...any) error }) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	var scopes, redirectURIs string
+	err := row.Scan(&client.ID, &client.ClientID, &client.SecretHash, &client.Name, &scopes, &redirectURIs, &client.Public, &client.Disabled, &client.CreatedBy, &client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	client.Scopes = strings.Fields(scopes)
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	return &client, nil
+}
+
+// CreateOAuthClient registra un cliente con el hash de su secreto (vacío para los clientes públicos)
+func CreateOAuthClient(clientID, secretHash string, req models.CreateOAuthClientRequest, createdBy int) (int, error) {
+	result, err := Database.Exec(
+		"INSERT INTO oauth_clients (client_id, secret_hash, name, scopes, redirect_uris, public, created_by) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		clientID, secretHash, req.Name, strings.Join(req.Scopes, " "), strings.Join(req.RedirectURIs, " "), req.Public, createdBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// FindOAuthClient busca un cliente por su ID interno
+func FindOAuthClient(id int) (*models.OAuthClient, error) {
+	return scanOAuthClient(Database.QueryRow("SELECT "+oauthClientColumns+" FROM oauth_clients WHERE id = ?", id))
+}
+
+// FindOAuthClientByClientID busca un cliente por su client_id
+func FindOAuthClientByClientID(clientID string) (*models.OAuthClient, error) {
+	return scanOAuthClient(Database.QueryRow("SELECT "+oauthClientColumns+" FROM oauth_clients WHERE client_id = ?", clientID))
+}
+
+// ListOAuthClients devuelve todos los clientes registrados
+func ListOAuthClients() ([]models.OAuthClient, error) {
+	rows, err := Database.Query("SELECT " + oauthClientColumns + " FROM oauth_clients ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []models.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+// DeleteOAuthClient elimina un cliente. Sus tokens dejan de ser aceptados.
+func DeleteOAuthClient(id int) (bool, error) {
+	result, err := Database.Exec("DELETE FROM oauth_clients WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"auth/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Propósitos de los tokens de un solo uso
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeMFALogin          = "mfa_login"
+	PurposeMagicLink         = "magic_link"
+	PurposeEmailChange       = "email_change"
+	PurposeEmailChangeUndo   = "email_change_undo"
+)
+
+// ErrInvalidToken indica que el token no existe, ya fue usado o expiró
+var ErrInvalidToken = errors.New("token inválido o expirado")
+
+// CreateOneTimeToken guarda el hash de un token de un solo uso
+func CreateOneTimeToken(userID int, purpose, tokenHash, data string, expiresAt time.Time) error {
+	_, err := Database.Exec(
+		"INSERT INTO one_time_tokens (user_id, purpose, token_hash, data, expires_at) VALUES (?, ?, ?, ?, ?)",
+		userID, purpose, tokenHash, data, expiresAt.UTC(),
+	)
+	return err
+}
+
+// InvalidateOneTimeTokens marca como usados los tokens pendientes de un usuario para un propósito
+func InvalidateOneTimeTokens(userID int, purpose string) error {
+	_, err := Database.Exec(
+		"UPDATE one_time_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		time.Now().UTC(), userID, purpose,
+	)
+	return err
+}
+
+// ConsumeOneTimeToken marca el token como usado dentro de la transacción y lo
+// devuelve. Devuelve ErrInvalidToken si no existe, ya fue usado o expiró.
+func ConsumeOneTimeToken(tx *sql.Tx, purpose, tokenHash string) (*models.OneTimeToken, error) {
+	token, err := findOneTimeToken(tx, purpose, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// La condición sobre used_at evita que dos solicitudes concurrentes usen el mismo token
+	result, err := tx.Exec("UPDATE one_time_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now().UTC(), token.ID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	return token, nil
+}
+
+// FindOneTimeToken devuelve un token vigente sin consumirlo, para validar la
+// solicitud antes de usarlo. Devuelve ErrInvalidToken si no existe, ya fue
+// usado o expiró.
+func FindOneTimeToken(purpose, tokenHash string) (*models.OneTimeToken, error) {
+	return findOneTimeToken(Database, purpose, tokenHash)
+}
+
+// rowQuerier es implementado tanto por *sql.DB como por *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// findOneTimeToken busca un token sin usar y no expirado
+func findOneTimeToken(q rowQuerier, purpose, tokenHash string) (*models.OneTimeToken, error) {
+	var token models.OneTimeToken
+	err := q.QueryRow(
+		"SELECT id, user_id, purpose, data, expires_at FROM one_time_tokens WHERE token_hash = ? AND purpose = ? AND used_at IS NULL",
+		tokenHash, purpose,
+	).Scan(&token.ID, &token.UserID, &token.Purpose, &token.Data, &token.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !time.Now().Before(token.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	return &token, nil
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AddPasswordHistory registra el hash de la contraseña actual del usuario y
+// conserva solo las keep más recientes
+func AddPasswordHistory(userID int, passwordHash string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	if _, err := Database.Exec(
+		"INSERT INTO password_history (user_id, password_hash, created_at) VALUES (?, ?, ?)",
+		userID, passwordHash, time.Now().UTC(),
+	); err != nil {
+		return err
+	}
+
+	// Eliminar las entradas anteriores a la más antigua que se conserva
+	var oldestKept int
+	err := Database.QueryRow(
+		"SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?",
+		userID, keep-1,
+	).Scan(&oldestKept)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = Database.Exec("DELETE FROM password_history WHERE user_id = ? AND id < ?", userID, oldestKept)
+	return err
+}
+
+// RecentPasswordHashes devuelve los hashes de las últimas limit contraseñas del usuario
+func RecentPasswordHashes(userID int, limit int) ([]string, error) {
+	rows, err := Database.Query(
+		"SELECT password_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?",
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
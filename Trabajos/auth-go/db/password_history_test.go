@@ -0,0 +1,46 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestPasswordHistory(t *testing.T) {
+	tests := []struct {
+		name  string
+		keep  int
+		added int
+		want  []string // Hashes conservados, del más reciente al más antiguo
+	}{
+		{"historial desactivado", 0, 3, nil},
+		{"menos contraseñas que el límite", 5, 2, []string{"hash-2", "hash-1"}},
+		{"se descartan las más antiguas", 2, 4, []string{"hash-4", "hash-3"}},
+		{"solo la última", 1, 3, []string{"hash-3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+
+			for i := 1; i <= tt.added; i++ {
+				if err := AddPasswordHistory(1, fmt.Sprintf("hash-%d", i), tt.keep); err != nil {
+					t.Fatalf("AddPasswordHistory: %v", err)
+				}
+			}
+			// Las contraseñas de otro usuario no cuentan para el límite
+			if err := AddPasswordHistory(2, "otro", tt.keep); err != nil {
+				t.Fatalf("AddPasswordHistory: %v", err)
+			}
+
+			// Leer todo lo guardado, no solo lo que pediría la política
+			hashes, err := RecentPasswordHashes(1, 100)
+			if err != nil {
+				t.Fatalf("RecentPasswordHashes: %v", err)
+			}
+			if !slices.Equal(hashes, tt.want) {
+				t.Errorf("historial = %v, se esperaba %v", hashes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package db
+
+import (
+	"auth/models"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrUnknownPermission indica que se asignó a un rol un permiso que no existe
+var ErrUnknownPermission = errors.New("permiso desconocido")
+
+// SeedRBAC crea los roles y permisos incluidos en el servicio si no existen
+// y asegura que el rol admin tenga todos los permisos
+func SeedRBAC() error {
+	roles := map[string]string{
+		models.RoleUser:  "Usuario registrado",
+		models.RoleAdmin: "Administrador del servicio",
+	}
+	for name, description := range roles {
+		if err := insertIfMissing("roles", name, description); err != nil {
+			return err
+		}
+	}
+	for name, description := range models.BuiltinPermissions {
+		if err := insertIfMissing("permissions", name, description); err != nil {
+			return err
+		}
+	}
+
+	// Asignar al rol admin los permisos que todavía no tenga
+	_, err := Database.Exec(
+		`INSERT INTO role_permissions (role_id, permission_id)
+			SELECT r.id, p.id FROM roles r, permissions p
+			WHERE r.name = ? AND NOT EXISTS (
+				SELECT 1 FROM role_permissions rp WHERE rp.role_id = r.id AND rp.permission_id = p.id
+			)`,
+		models.RoleAdmin,
+	)
+	return err
+}
+
+// insertIfMissing crea un rol o permiso incluido si todavía no existe
+func insertIfMissing(table, name, description string) error {
+	var count int
+	if err := Database.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE name = ?", name).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := Database.Exec("INSERT INTO "+table+" (name, description, builtin) VALUES (?, ?, TRUE)", name, description)
+	return err
+}
+
+// roleColumns son las columnas que se leen al cargar un rol
+const roleColumns = "id, name, description, builtin, created_at"
+
+// scanRole lee un rol con las columnas de roleColumns
+func scanRole(row interface{ Scan(...any) error }) (*models.Role, error) {
+	var role models.Role
+	if err := row.Scan(&role.ID, &role.Name, &role.Description, &role.Builtin, &role.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// FindRole busca un rol por su ID, con sus permisos
+func FindRole(id int) (*models.Role, error) {
+	return loadRole(Database.QueryRow("SELECT "+roleColumns+" FROM roles WHERE id = ?", id))
+}
+
+// FindRoleByName busca un rol por su nombre, con sus permisos
+func FindRoleByName(name string) (*models.Role, error) {
+	return loadRole(Database.QueryRow("SELECT "+roleColumns+" FROM roles WHERE name = ?", name))
+}
+
+// loadRole lee un rol y carga sus permisos
+func loadRole(row *sql.Row) (*models.Role, error) {
+	role, err := scanRole(row)
+	if err != nil {
+		return nil, err
+	}
+	if role.Permissions, err = RolePermissions(role.Name); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// RoleExists indica si existe un rol con ese nombre
+func RoleExists(name string) (bool, error) {
+	var count int
+	err := Database.QueryRow("SELECT COUNT(*) FROM roles WHERE name = ?", name).Scan(&count)
+	return count > 0, err
+}
+
+// RolePermissions devuelve los nombres de los permisos de un rol, ordenados
+func RolePermissions(roleName string) ([]string, error) {
+	rows, err := Database.Query(
+		`SELECT p.name FROM permissions p
+			JOIN role_permissions rp ON rp.permission_id = p.id
+			JOIN roles r ON r.id = rp.role_id
+			WHERE r.name = ? ORDER BY p.name`,
+		roleName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, name)
+	}
+	return permissions, rows.Err()
+}
+
+// ListRoles devuelve todos los roles con sus permisos
+func ListRoles() ([]models.Role, error) {
+	rows, err := Database.Query("SELECT " + roleColumns + " FROM roles ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Cargar los permisos de cada rol en una sola consulta
+	rows, err = Database.Query(
+		"SELECT rp.role_id, p.name FROM role_permissions rp JOIN permissions p ON p.id = rp.permission_id",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byRole := make(map[int][]string)
+	for rows.Next() {
+		var roleID int
+		var name string
+		if err := rows.Scan(&roleID, &name); err != nil {
+			return nil, err
+		}
+		byRole[roleID] = append(byRole[roleID], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range roles {
+		roles[i].Permissions = byRole[roles[i].ID]
+		if roles[i].Permissions == nil {
+			roles[i].Permissions = []string{}
+		}
+		sort.Strings(roles[i].Permissions)
+	}
+	return roles, nil
+}
+
+// CreateRole crea un rol con los permisos indicados. Devuelve
+// ErrUnknownPermission si alguno no existe.
+func CreateRole(name, description string, permissions []string) (int, error) {
+	tx, err := Database.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO roles (name, description) VALUES (?, ?)", name, description)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := setRolePermissions(tx, int(id), permissions); err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+// UpdateRole reemplaza los permisos de un rol y, si se indica, su descripción.
+// Devuelve ErrUnknownPermission si alguno de los permisos no existe.
+func UpdateRole(id int, description *string, permissions []string) error {
+	tx, err := Database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if description != nil {
+		if _, err := tx.Exec("UPDATE roles SET description = ? WHERE id = ?", *description, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", id); err != nil {
+		return err
+	}
+	if err := setRolePermissions(tx, id, permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setRolePermissions asigna los permisos al rol dentro de la transacción
+func setRolePermissions(tx *sql.Tx, roleID int, permissions []string) error {
+	seen := make(map[string]bool)
+	for _, name := range permissions {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		result, err := tx.Exec(
+			"INSERT INTO role_permissions (role_id, permission_id) SELECT ?, id FROM permissions WHERE name = ?",
+			roleID, name,
+		)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return ErrUnknownPermission
+		}
+	}
+	return nil
+}
+
+// DeleteRole elimina un rol que ningún usuario tiene asignado. Las
+// invitaciones pendientes que lo otorgaban se eliminan y las claves de API
+// con ese rol se revocan.
+func DeleteRole(role *models.Role) error {
+	tx, err := Database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM invitations WHERE role = ? AND used_at IS NULL", role.Name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE api_keys SET revoked_at = ? WHERE role = ? AND revoked_at IS NULL", time.Now().UTC(), role.Name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM roles WHERE id = ?", role.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListPermissions devuelve todos los permisos
+func ListPermissions() ([]models.Permission, error) {
+	rows, err := Database.Query("SELECT id, name, description, builtin FROM permissions ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var p models.Permission
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Builtin); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// FindPermission busca un permiso por su ID
+func FindPermission(id int) (*models.Permission, error) {
+	var p models.Permission
+	err := Database.QueryRow("SELECT id, name, description, builtin FROM permissions WHERE id = ?", id).
+		Scan(&p.ID, &p.Name, &p.Description, &p.Builtin)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreatePermission crea un permiso y lo asigna al rol admin, que tiene todos los permisos
+func CreatePermission(name, description string) (int, error) {
+	tx, err := Database.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO permissions (name, description) VALUES (?, ?)", name, description)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO role_permissions (role_id, permission_id) SELECT id, ? FROM roles WHERE name = ?",
+		id, models.RoleAdmin,
+	); err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+// DeletePermission elimina un permiso y lo quita de todos los roles
+func DeletePermission(id int) error {
+	_, err := Database.Exec("DELETE FROM permissions WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"auth/models"
+	"time"
+)
+
+// CreateRefreshToken guarda el hash de un nuevo token de renovación
+func CreateRefreshToken(userID int, familyID, tokenHash string, expiresAt time.Time) error {
+	_, err := Database.Exec(
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES (?, ?, ?, ?)",
+		userID, familyID, tokenHash, expiresAt.UTC(),
+	)
+	return err
+}
+
+// FindRefreshToken busca un token de renovación por su hash
+func FindRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := Database.QueryRow(
+		"SELECT id, user_id, family_id, expires_at, used_at, revoked_at, created_at FROM refresh_tokens WHERE token_hash = ?",
+		tokenHash,
+	).Scan(&token.ID, &token.UserID, &token.FamilyID, &token.ExpiresAt, &token.UsedAt, &token.RevokedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed marca un token como utilizado. Devuelve false si otro
+// proceso ya lo había usado o revocado, lo que debe tratarse como reutilización.
+func MarkRefreshTokenUsed(id int) (bool, error) {
+	result, err := Database.Exec(
+		"UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL",
+		time.Now().UTC(), id,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// RevokeRefreshFamily revoca todos los tokens de una misma familia
+func RevokeRefreshFamily(familyID string) error {
+	_, err := Database.Exec(
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), familyID,
+	)
+	return err
+}
+
+// RevokeUserRefreshTokens revoca todos los tokens de renovación de un usuario
+func RevokeUserRefreshTokens(userID int) error {
+	_, err := Database.Exec(
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), userID,
+	)
+	return err
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"auth/models"
+	"time"
+)
+
+// sessionColumns son las columnas que se leen al cargar una sesión
+const sessionColumns = "id, user_id, user_agent, ip, created_at, last_seen_at, revoked_at"
+
+// scanSession lee una sesión con las columnas de sessionColumns
+func scanSession(row interface{ Scan(...any) error }) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CreateSession registra una sesión nueva
+func CreateSession(id string, userID int, userAgent, ip string) error {
+	now := time.Now().UTC()
+	_, err := Database.Exec(
+		"INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?, ?)",
+		id, userID, userAgent, ip, now, now,
+	)
+	return err
+}
+
+// FindSession busca una sesión por su ID
+func FindSession(id string) (*models.Session, error) {
+	return scanSession(Database.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id))
+}
+
+// ListActiveSessions devuelve las sesiones no revocadas del usuario con
+// actividad posterior a since, de la más reciente a la más antigua
+func ListActiveSessions(userID int, since time.Time) ([]models.Session, error) {
+	rows, err := Database.Query(
+		"SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND last_seen_at > ? ORDER BY last_seen_at DESC",
+		userID, since.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// ListUserSessions devuelve todas las sesiones del usuario, incluidas las
+// revocadas, de la más reciente a la más antigua
+func ListUserSessions(userID int) ([]models.Session, error) {
+	rows, err := Database.Query(
+		"SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? ORDER BY created_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession registra la actividad de la sesión. Para no escribir en cada
+// solicitud, solo se actualiza si la última actividad es anterior a since.
+func TouchSession(id, ip string, now, since time.Time) error {
+	_, err := Database.Exec(
+		"UPDATE sessions SET last_seen_at = ?, ip = ? WHERE id = ? AND last_seen_at < ?",
+		now.UTC(), ip, id, since.UTC(),
+	)
+	return err
+}
+
+// RevokeSession marca la sesión como revocada. Devuelve false si no existe
+// o ya estaba revocada.
+func RevokeSession(id string) (bool, error) {
+	result, err := Database.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
@@ -0,0 +1,65 @@
+package mailer
+
+import (
+	"auth/config"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// Message representa un correo de texto plano
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer envía correos electrónicos
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New crea el Mailer indicado en la configuración (MAIL_DRIVER)
+func New(cfg config.Config) (Mailer, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST es obligatorio con MAIL_DRIVER=smtp")
+		}
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPass,
+			From:     cfg.MailFrom,
+		}, nil
+	case "outbox":
+		return NewOutboxMailer(cfg.MailOutboxDir, cfg.MailFrom)
+	default:
+		return nil, fmt.Errorf("MAIL_DRIVER desconocido: %q", cfg.MailDriver)
+	}
+}
+
+// format genera el mensaje en formato RFC 5322 con cuerpo UTF-8
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// validateHeaders evita la inyección de cabeceras a través de los campos del mensaje
+func validateHeaders(msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("cabecera de correo inválida")
+	}
+	return nil
+}
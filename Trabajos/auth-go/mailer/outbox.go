@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"auth/security"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OutboxMailer guarda cada correo como un archivo .eml en un directorio en
+// lugar de enviarlo. Sirve para desarrollo local y pruebas.
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+// NewOutboxMailer crea el directorio de salida si no existe
+func NewOutboxMailer(dir, from string) (*OutboxMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error al crear el directorio de salida de correos: %w", err)
+	}
+	return &OutboxMailer{Dir: dir, From: from}, nil
+}
+
+// Send escribe el mensaje en un archivo nuevo dentro del directorio
+func (m *OutboxMailer) Send(msg Message) error {
+	if err := validateHeaders(msg); err != nil {
+		return err
+	}
+
+	id, err := security.NewRandomID()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405Z"), id[:8])
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o644)
+}
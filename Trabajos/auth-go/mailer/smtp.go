@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+)
+
+// SMTPMailer envía los correos a través de un servidor SMTP
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send envía el mensaje. Si hay usuario configurado se autentica con PLAIN,
+// que net/smtp solo permite sobre TLS o hacia localhost.
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := validateHeaders(msg); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.From, []string{msg.To}, format(m.From, msg))
+}
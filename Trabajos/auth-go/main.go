@@ -2,11 +2,16 @@ package main
 
 import (
 	"auth/config"
+	"auth/controllers"
 	"auth/db"
+	"auth/mailer"
+	"auth/middleware"
 	"auth/routes"
+	"auth/store"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,12 +23,60 @@ func main() {
 		log.Fatalf("Error al cargar configuración: %v", err)
 	}
 
+	// Subcomando migrate: gestiona el esquema de la base de datos y termina
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("Error en las migraciones: %v", err)
+		}
+		return
+	}
+
+	// Cargar las claves de firma de los JWT
+	if err := middleware.LoadKeys(cfg); err != nil {
+		log.Fatalf("Error al cargar las claves de firma: %v", err)
+	}
+
 	// Inicializar base de datos
 	if err := db.InitializeDB(cfg); err != nil {
 		log.Fatalf("Error al inicializar base de datos: %v", err)
 	}
 	defer db.Database.Close()
 
+	// Inicializar el almacén de usuarios según DB_DRIVER
+	users, err := store.New(cfg, db.Database)
+	if err != nil {
+		log.Fatalf("Error al inicializar el almacén de usuarios: %v", err)
+	}
+	middleware.Users = users
+
+	// Eliminar periódicamente las cuentas cuyo periodo de gracia venció
+	store.StartDeletionPurge(users, cfg.AccountPurgeInterval)
+
+	// Inicializar el almacén de tokens revocados
+	if err := middleware.InitRevocationStore(db.Database, cfg.RevocationSyncInterval); err != nil {
+		log.Fatalf("Error al inicializar el almacén de tokens revocados: %v", err)
+	}
+
+	// Depurar periódicamente los eventos de auditoría antiguos
+	db.StartAuditRetention(cfg.AuditRetention, cfg.AuditPruneInterval)
+
+	// Sin administradores nadie puede crear invitaciones: generar una inicial
+	if err := controllers.EnsureBootstrapInvitation(cfg, users); err != nil {
+		log.Fatalf("Error al crear la invitación inicial de administrador: %v", err)
+	}
+
+	// Cargar la política de contraseñas y el archivo de contraseñas filtradas
+	policy, err := controllers.LoadPasswordPolicy(cfg)
+	if err != nil {
+		log.Fatalf("Error al cargar la política de contraseñas: %v", err)
+	}
+
+	// Inicializar el envío de correos
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Error al inicializar el envío de correos: %v", err)
+	}
+
 	// Inicializar el router
 	router := gin.Default()
 
@@ -32,7 +85,7 @@ func main() {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -43,7 +96,7 @@ func main() {
 	})
 
 	// Configurar rutas
-	routes.SetupRoutes(router, cfg)
+	routes.SetupRoutes(router, cfg, mail, users, policy)
 
 	// Ruta para verificar que el servidor está funcionando
 	router.GET("/health", func(c *gin.Context) {
@@ -2,9 +2,14 @@ package middleware
 
 import (
 	"auth/config"
+	"auth/db"
+	"auth/security"
+	"auth/store"
+	"database/sql"
 	"errors"
-	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,37 +17,125 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Claims representa los datos del token JWT
+// Claims representa los datos del token JWT. Los tokens de servicio
+// (client_credentials) no tienen usuario: llevan ClientID y Scope. Los tokens
+// emitidos a una aplicación en nombre de un usuario (OpenID Connect) llevan
+// el usuario, ClientID, Scope y la aplicación como audience.
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Role   string `json:"role"`
-	Email  string `json:"email"`
+	UserID    int    `json:"user_id"`
+	Role      string `json:"role"`
+	Email     string `json:"email"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"` // Scopes separados por espacios
+	SessionID string `json:"sid,omitempty"`   // Sesión (familia de tokens de renovación) del token
+	// Permisos del rol al emitir el token; los cambios en el rol se reflejan al renovarlo
+	Permissions []string `json:"perms,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken genera un token JWT con los datos del usuario
-func GenerateToken(userID int, username string, email string, role string, jwtSecret string) (string, time.Time, error) {
-	// Establecer tiempo de expiración (1 hora)
-	expirationTime := time.Now().Add(time.Hour * 24) //! cambiar a 1 hora
+// IsClientToken indica si el token fue emitido a un cliente OAuth y no a un usuario
+func (c *Claims) IsClientToken() bool {
+	return c.ClientID != "" && c.UserID == 0
+}
+
+// IsDelegatedToken indica si el token fue emitido a una aplicación en nombre
+// de un usuario (flujo OpenID Connect)
+func (c *Claims) IsDelegatedToken() bool {
+	return c.UserID != 0 && (c.ClientID != "" || len(c.Audience) > 0)
+}
 
+// GenerateToken genera un token JWT con los datos del usuario y los permisos
+// de su rol para la sesión indicada
+func GenerateToken(userID int, username string, email string, role string, permissions []string, sessionID string, ttl time.Duration) (string, time.Time, error) {
 	// Crear claims con la información del usuario
 	claims := &Claims{
-		UserID: userID,
-		Role:   role,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   username,
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "auth-service",
-		},
-	}
-
-	// Crear token con el algoritmo de firma
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Firmar el token con la clave secreta
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+		UserID:      userID,
+		Role:        role,
+		Email:       email,
+		SessionID:   sessionID,
+		Permissions: permissions,
+	}
+	return signClaims(claims, username, ttl)
+}
+
+// GenerateScopedToken genera un token emitido a una aplicación en nombre del
+// usuario con los scopes concedidos (flujo OpenID Connect). La aplicación va
+// como audience, y el token solo se acepta en /oauth/userinfo.
+func GenerateScopedToken(userID int, username string, email string, role string, clientID string, scopes []string, sessionID string, ttl time.Duration) (string, time.Time, error) {
+	claims := &Claims{
+		UserID:    userID,
+		Role:      role,
+		Email:     email,
+		ClientID:  clientID,
+		Scope:     strings.Join(scopes, " "),
+		SessionID: sessionID,
+	}
+	claims.Audience = jwt.ClaimStrings{clientID}
+	return signClaims(claims, username, ttl)
+}
+
+// IDTokenClaims representa los claims de un id_token de OpenID Connect
+type IDTokenClaims struct {
+	Nonce             string           `json:"nonce,omitempty"`
+	AuthTime          *jwt.NumericDate `json:"auth_time,omitempty"`
+	PreferredUsername string           `json:"preferred_username,omitempty"`
+	Email             string           `json:"email,omitempty"`
+	EmailVerified     *bool            `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateIDToken firma un id_token para la aplicación (audience) con la clave activa
+func GenerateIDToken(claims *IDTokenClaims, issuer, subject, audience string, ttl time.Duration) (string, error) {
+	jti, err := security.NewRandomID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		Issuer:    issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	return Keys.Sign(claims)
+}
+
+// GenerateClientToken genera un token JWT para un cliente OAuth con los scopes concedidos
+func GenerateClientToken(clientID string, scopes []string, ttl time.Duration) (string, time.Time, error) {
+	claims := &Claims{
+		ClientID: clientID,
+		Scope:    strings.Join(scopes, " "),
+	}
+	return signClaims(claims, clientID, ttl)
+}
+
+// signClaims completa los claims registrados y firma el token
+func signClaims(claims *Claims, subject string, ttl time.Duration) (string, time.Time, error) {
+	// Establecer tiempo de expiración (tokens de acceso de corta duración)
+	expirationTime := time.Now().Add(ttl)
+
+	// Identificador único del token (jti) para poder revocarlo
+	jti, err := security.NewRandomID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Se conserva el audience que haya indicado quien genera el token
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		Subject:   subject,
+		Audience:  claims.Audience,
+		ExpiresAt: jwt.NewNumericDate(expirationTime),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    "auth-service",
+	}
+
+	// Firmar el token con la clave activa
+	tokenString, err := Keys.Sign(claims)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -50,8 +143,188 @@ func GenerateToken(userID int, username string, email string, role string, jwtSe
 	return tokenString, expirationTime, nil
 }
 
-// AuthMiddleware verifica que el token JWT sea válido
+// TokenError describe por qué se rechazó un token y con qué código HTTP responder
+type TokenError struct {
+	Status  int
+	Message string
+}
+
+func (e *TokenError) Error() string {
+	return e.Message
+}
+
+// Motivos por los que ValidateAccessToken rechaza un token
+var (
+	ErrTokenExpired  = &TokenError{Status: http.StatusUnauthorized, Message: "token expirado"}
+	ErrTokenInvalid  = &TokenError{Status: http.StatusUnauthorized, Message: "token inválido"}
+	ErrTokenRevoked  = &TokenError{Status: http.StatusUnauthorized, Message: "token revocado"}
+	ErrUserNotFound  = &TokenError{Status: http.StatusUnauthorized, Message: "usuario no encontrado"}
+	ErrUserDisabled  = &TokenError{Status: http.StatusForbidden, Message: "la cuenta está deshabilitada"}
+	ErrClientRevoked = &TokenError{Status: http.StatusUnauthorized, Message: "cliente no autorizado"}
+	ErrAPIKeyInvalid = &TokenError{Status: http.StatusUnauthorized, Message: "clave de API inválida, expirada o revocada"}
+	ErrMustReset     = &TokenError{Status: http.StatusForbidden, Message: "debe restablecer su contraseña"}
+	ErrUserDeleted   = &TokenError{Status: http.StatusForbidden, Message: "la cuenta está pendiente de eliminación"}
+	ErrDelegated     = &TokenError{Status: http.StatusForbidden, Message: "los tokens emitidos a aplicaciones solo pueden usarse en /oauth/userinfo"}
+)
+
+// ValidateAccessToken verifica la firma y la expiración del token, que no haya
+// sido revocado y que la cuenta siga existiendo, habilitada y sin un
+// restablecimiento de contraseña pendiente. Los rechazos se devuelven como
+// *TokenError; cualquier otro error es un fallo interno.
+func ValidateAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := Keys.Parse(tokenString, claims)
+	if err != nil {
+		// En jwt v5, la validación de errores es diferente
+		if errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrTokenInvalid
+	}
+
+	// Verificar que el token es válido
+	if !token.Valid || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, ErrTokenInvalid
+	}
+
+	// Verificar que ni el token ni su sesión hayan sido revocados (por ejemplo, tras cerrar sesión)
+	if Revocations.IsRevoked(claims.ID) || (claims.SessionID != "" && Revocations.IsRevoked(claims.SessionID)) {
+		return nil, ErrTokenRevoked
+	}
+
+	// Los tokens de servicio y los emitidos a aplicaciones dependen de que el
+	// cliente siga registrado y habilitado
+	if claims.ClientID != "" {
+		var disabled bool
+		err = db.Database.QueryRow("SELECT disabled FROM oauth_clients WHERE client_id = ?", claims.ClientID).Scan(&disabled)
+		if err == sql.ErrNoRows || (err == nil && disabled) {
+			return nil, ErrClientRevoked
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if claims.IsClientToken() {
+		return claims, nil
+	}
+
+	// Verificar que la cuenta siga existiendo y no esté deshabilitada
+	user, err := Users.FindByID(claims.UserID)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	if user.DeleteAfter != nil {
+		return nil, ErrUserDeleted
+	}
+	// La cuenta se recupera restableciendo la contraseña por correo
+	if user.MustResetPassword {
+		return nil, ErrMustReset
+	}
+
+	return claims, nil
+}
+
+// ValidateAPIKey verifica una clave de API y devuelve los claims equivalentes
+// a los de un token de acceso junto con el ID de la clave. Los permisos
+// efectivos son los que el rol de la clave comparte con el rol actual del
+// usuario, y si el usuario ya no tiene todos los permisos de la clave se usa su rol.
+func ValidateAPIKey(key string) (*Claims, int, error) {
+	stored, err := db.FindAPIKeyByHash(security.HashToken(key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, ErrAPIKeyInvalid
+		}
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	if !stored.IsActive(now) {
+		return nil, 0, ErrAPIKeyInvalid
+	}
+
+	// Verificar que la cuenta siga existiendo y habilitada
+	user, err := Users.FindByID(stored.UserID)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			return nil, 0, ErrUserNotFound
+		}
+		return nil, 0, err
+	}
+	if user.Disabled {
+		return nil, 0, ErrUserDisabled
+	}
+	if user.DeleteAfter != nil {
+		return nil, 0, ErrUserDeleted
+	}
+	// Si un administrador obligó a cambiar la contraseña, la cuenta pudo estar comprometida
+	if user.MustResetPassword {
+		return nil, 0, ErrMustReset
+	}
+
+	keyPermissions, err := db.RolePermissions(stored.Role)
+	if err != nil {
+		return nil, 0, err
+	}
+	userPermissions, err := db.RolePermissions(user.Role)
+	if err != nil {
+		return nil, 0, err
+	}
+	effectiveRole := stored.Role
+	permissions := []string{}
+	for _, permission := range keyPermissions {
+		if slices.Contains(userPermissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	if len(permissions) < len(keyPermissions) {
+		effectiveRole = user.Role
+	}
+
+	// Registrar el uso como mucho una vez por minuto
+	if err := db.TouchAPIKey(stored.ID, now, now.Add(-time.Minute)); err != nil {
+		log.Printf("Error al registrar el uso de la clave de API %d: %v", stored.ID, err)
+	}
+
+	claims := &Claims{
+		UserID:      stored.UserID,
+		Role:        effectiveRole,
+		Email:       user.Email,
+		Permissions: permissions,
+	}
+	claims.Subject = user.Username
+	if stored.ExpiresAt.Valid {
+		claims.ExpiresAt = jwt.NewNumericDate(stored.ExpiresAt.Time)
+	}
+
+	return claims, stored.ID, nil
+}
+
+// Users es el almacén de usuarios con el que se comprueba el estado de las cuentas
+var Users store.UserStore
+
+// AuthMiddleware verifica las credenciales de la solicitud: un token JWT
+// ("Bearer <token>") o una clave de API ("ApiKey <clave>"). Rechaza los tokens
+// emitidos a aplicaciones en nombre del usuario, que solo sirven para userinfo.
 func AuthMiddleware(cfg config.Config) gin.HandlerFunc {
+	return authMiddleware(false)
+}
+
+// UserInfoAuthMiddleware es AuthMiddleware para /oauth/userinfo, donde se
+// aceptan los tokens emitidos a aplicaciones. La ruta debe exigir además el
+// scope openid con ScopeMiddleware.
+func UserInfoAuthMiddleware(cfg config.Config) gin.HandlerFunc {
+	return authMiddleware(true)
+}
+
+// authMiddleware verifica las credenciales; allowDelegated indica si se
+// aceptan los tokens emitidos a aplicaciones en nombre del usuario
+func authMiddleware(allowDelegated bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Obtener el token del encabezado Authorization
 		authHeader := c.GetHeader("Authorization")
@@ -61,49 +334,114 @@ func AuthMiddleware(cfg config.Config) gin.HandlerFunc {
 			return
 		}
 
-		// El token debe tener el formato "Bearer <token>"
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		// El encabezado debe tener el formato "<esquema> <credencial>"
+		scheme, credential, ok := strings.Cut(authHeader, " ")
+		if !ok || credential == "" || strings.Contains(credential, " ") {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "formato de token inválido"})
 			c.Abort()
 			return
 		}
 
-		// Extraer el token
-		tokenString := tokenParts[1]
-
-		// Validar el token
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			// Verificar que el algoritmo de firma es el esperado
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("método de firma inesperado: %v", token.Header["alg"])
+		// Extraer y validar el token o la clave
+		var claims *Claims
+		var apiKeyID int
+		var err error
+		switch scheme {
+		case "Bearer":
+			claims, err = ValidateAccessToken(credential)
+			if err == nil && claims.IsDelegatedToken() && !allowDelegated {
+				err = ErrDelegated
 			}
-			return []byte(cfg.JWTSecret), nil
-		})
-		// Manejar errores de validación
+		case "ApiKey":
+			claims, apiKeyID, err = ValidateAPIKey(credential)
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "formato de token inválido"})
+			c.Abort()
+			return
+		}
 		if err != nil {
-			// En jwt v5, la validación de errores es diferente
-			if errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "token expirado"})
+			var tokenErr *TokenError
+			if errors.As(err, &tokenErr) {
+				c.JSON(tokenErr.Status, gin.H{"error": tokenErr.Message})
 			} else {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "token inválido"})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error al verificar el usuario"})
 			}
 			c.Abort()
 			return
 		}
 
-		// Verificar que el token es válido
-		if !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "token inválido"})
-			c.Abort()
-			return
-		}
 		// Establecer los datos del usuario en el contexto
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
 		c.Set("username", claims.Subject)
 		c.Set("email", claims.Email)
+		c.Set("jti", claims.ID)
+		if claims.ExpiresAt != nil {
+			c.Set("token_expires_at", claims.ExpiresAt.Time)
+		}
+		c.Set("client_id", claims.ClientID)
+		c.Set("scopes", strings.Fields(claims.Scope))
+		c.Set("api_key_id", apiKeyID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("permissions", claims.Permissions)
+
+		// Registrar la actividad de la sesión como mucho una vez por minuto
+		if claims.SessionID != "" {
+			now := time.Now()
+			if err := db.TouchSession(claims.SessionID, c.ClientIP(), now, now.Add(-time.Minute)); err != nil {
+				log.Printf("Error al registrar la actividad de la sesión %s: %v", claims.SessionID, err)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireUser rechaza los tokens de servicio en rutas que actúan sobre la cuenta del usuario
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt("user_id") == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "esta ruta requiere un token de usuario"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ScopeMiddleware verifica que el token incluya todos los scopes requeridos.
+// Es el equivalente de RoleMiddleware para los tokens de servicio.
+func ScopeMiddleware(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := make(map[string]bool)
+		for _, scope := range c.GetStringSlice("scopes") {
+			granted[scope] = true
+		}
+
+		for _, scope := range scopes {
+			if !granted[scope] {
+				c.JSON(http.StatusForbidden, gin.H{"error": "el token no tiene el scope requerido: " + scope})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission verifica que el token incluya todos los permisos indicados
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("permissions")
+		for _, permission := range permissions {
+			if !slices.Contains(granted, permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "no tienes permisos para acceder a este recurso"})
+				c.Abort()
+				return
+			}
+		}
 
 		c.Next()
 	}
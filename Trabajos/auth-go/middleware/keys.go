@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"auth/config"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey es una clave de firma o verificación identificada por su kid
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   any              // clave privada o secreto HMAC; nil si solo sirve para verificar
+	verify any              // clave pública o secreto HMAC
+	public crypto.PublicKey // nil para HMAC, que no se publica
+}
+
+// KeySet contiene la clave activa con la que se firman los tokens y todas las
+// claves aceptadas al verificarlos. Mantener claves anteriores en el conjunto
+// permite rotarlas sin invalidar los tokens ya emitidos.
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// Keys es el conjunto de claves usado para firmar y verificar los tokens
+var Keys *KeySet
+
+// LoadKeys inicializa Keys según JWT_ALG. Con HS256 se usa JWT_SECRET; con
+// RS256 o EdDSA se leen las claves PEM de JWT_KEYS_DIR: cada archivo
+// <kid>.pem es una clave privada y cada <kid>.pub.pem una clave pública
+// retirada que solo se usa para verificar tokens emitidos antes de la rotación.
+func LoadKeys(cfg config.Config) error {
+	if cfg.JWTAlgorithm == "HS256" {
+		key := &signingKey{
+			method: jwt.SigningMethodHS256,
+			sign:   []byte(cfg.JWTSecret),
+			verify: []byte(cfg.JWTSecret),
+		}
+		Keys = &KeySet{active: key, keys: map[string]*signingKey{"": key}}
+		return nil
+	}
+
+	keys, err := loadKeyDir(cfg.JWTKeysDir)
+	if err != nil {
+		return err
+	}
+
+	activeKID := cfg.JWTActiveKID
+	if activeKID == "" {
+		// Sin JWT_ACTIVE_KID se admite una única clave privada
+		for kid, key := range keys {
+			if key.sign == nil {
+				continue
+			}
+			if activeKID != "" {
+				return fmt.Errorf("hay varias claves privadas en %s: indica JWT_ACTIVE_KID", cfg.JWTKeysDir)
+			}
+			activeKID = kid
+		}
+	}
+
+	active, ok := keys[activeKID]
+	if !ok || active.sign == nil {
+		return fmt.Errorf("no se encontró la clave privada %q en %s", activeKID, cfg.JWTKeysDir)
+	}
+	if active.method.Alg() != cfg.JWTAlgorithm {
+		return fmt.Errorf("la clave %q es %s, pero JWT_ALG es %s", activeKID, active.method.Alg(), cfg.JWTAlgorithm)
+	}
+
+	Keys = &KeySet{active: active, keys: keys}
+	return nil
+}
+
+// loadKeyDir lee todas las claves PEM de un directorio
+func loadKeyDir(dir string) (map[string]*signingKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no hay claves .pem en %s", dir)
+	}
+
+	keys := make(map[string]*signingKey)
+	for _, file := range files {
+		name := filepath.Base(file)
+		publicOnly := strings.HasSuffix(name, ".pub.pem")
+		kid := strings.TrimSuffix(strings.TrimSuffix(name, ".pem"), ".pub")
+
+		key, err := loadKeyFile(file, kid, publicOnly)
+		if err != nil {
+			return nil, fmt.Errorf("error al leer la clave %s: %w", file, err)
+		}
+
+		// Si existen ambos archivos, la clave privada tiene prioridad
+		if existing, ok := keys[kid]; ok && existing.sign != nil {
+			continue
+		}
+		keys[kid] = key
+	}
+
+	return keys, nil
+}
+
+// loadKeyFile interpreta una clave privada (PKCS#1 o PKCS#8) o pública (PKIX)
+func loadKeyFile(path, kid string, publicOnly bool) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("el archivo no contiene un bloque PEM")
+	}
+
+	var private any
+	var public any
+	if publicOnly {
+		if public, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	} else {
+		if block.Type == "RSA PRIVATE KEY" {
+			private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		} else {
+			private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("tipo de clave no soportado (se admiten RSA y Ed25519)")
+		}
+		public = signer.Public()
+	}
+
+	key := &signingKey{kid: kid, sign: private, verify: public, public: public}
+	switch public.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("tipo de clave no soportado (se admiten RSA y Ed25519)")
+	}
+
+	return key, nil
+}
+
+// Sign firma los claims con la clave activa e incluye su kid en la cabecera
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	if ks.active.kid != "" {
+		token.Header["kid"] = ks.active.kid
+	}
+	return token.SignedString(ks.active.sign)
+}
+
+// Parse verifica la firma del token con la clave indicada por su kid
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("clave de firma desconocida: %q", kid)
+		}
+
+		// Verificar que el algoritmo de firma es el de la clave
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("método de firma inesperado: %v", token.Header["alg"])
+		}
+		return key.verify, nil
+	})
+}
+
+// JWK representa una clave pública en formato JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet representa el documento publicado en /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS devuelve las claves públicas del conjunto. Las claves HMAC no se publican.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"auth/config"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claves generadas una sola vez, porque generar claves RSA es lento
+var (
+	testRSAKey     = mustGenerateRSAKey()
+	testOtherRSA   = mustGenerateRSAKey()
+	_, testEd25519 = mustGenerateEd25519Key()
+)
+
+func mustGenerateRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustGenerateEd25519Key() (ed25519.PublicKey, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return public, private
+}
+
+// writePEM escribe un archivo PEM en dir
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writePrivateKey escribe <kid>.pem; las claves RSA en PKCS#1 y las demás en PKCS#8
+func writePrivateKey(t *testing.T, dir, kid string, key any) {
+	t.Helper()
+
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		writePEM(t, dir, kid+".pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+		return
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid+".pem", "PRIVATE KEY", der)
+}
+
+// writePublicKey escribe <kid>.pub.pem, una clave retirada
+func writePublicKey(t *testing.T, dir, kid string, key any) {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid+".pub.pem", "PUBLIC KEY", der)
+}
+
+// loadTestKeys ejecuta LoadKeys y restaura Keys al terminar la prueba
+func loadTestKeys(t *testing.T, cfg config.Config) error {
+	t.Helper()
+
+	previous := Keys
+	t.Cleanup(func() { Keys = previous })
+	return LoadKeys(cfg)
+}
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+}
+
+func TestLoadKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		alg        string
+		activeKID  string
+		setup      func(t *testing.T, dir string)
+		wantActive string
+		wantErr    bool
+	}{
+		{"directorio vacío", "RS256", "", func(t *testing.T, dir string) {}, "", true},
+		{"una clave privada sin JWT_ACTIVE_KID", "RS256", "", func(t *testing.T, dir string) {
+			writePrivateKey(t, dir, "unica", testRSAKey)
+		}, "unica", false},
+		{"una clave privada y otra retirada", "RS256", "", func(t *testing.T, dir string) {
+			writePrivateKey(t, dir, "nueva", testRSAKey)
+			writePublicKey(t, dir, "anterior", &testOtherRSA.PublicKey)
+		}, "nueva", false},
+		{"varias claves privadas sin JWT_ACTIVE_KID", "RS256", "", func(t *testing.T, dir string) {
+			writePrivateKey(t, dir, "a", testRSAKey)
+			writePrivateKey(t, dir, "b", testOtherRSA)
+		}, "", true},
+		{"varias claves privadas con JWT_ACTIVE_KID", "RS256", "b", func(t *testing.T, dir string) {
+			writePrivateKey(t, dir, "a", testRSAKey)
+			writePrivateKey(t, dir, "b", testOtherRSA)
+		}, "b", false},
+		{"JWT_ACTIVE_KID desconocido", "RS256", "c", func(t *testing.T, dir string) {
+			writePrivateKey(t, dir, "a", testRSAKey)
+		}, "", true},
+		{"JWT_ACTIVE_KID de una clave retirada", "RS256", "anterior", func(t *testing.T, dir string) {
+			writePrivateKey(t, dir, "nueva", testRSAKey)
+			writePublicKey(t, dir, "anterior", &testOtherRSA.PublicKey)
+		}, "", true},
+		{"clave privada y pública con el mismo kid", "RS256", "", func(t *testing.T, dir string) {
+			writePrivateKey(t, dir, "misma", testRSAKey)
+			writePublicKey(t, dir, "misma", &testRSAKey.PublicKey)
+		}, "misma", false},
+		{"Ed25519 en PKCS#8", "EdDSA", "", func(t *testing.T, dir string) {
+			writePrivateKey(t, dir, "ed", testEd25519)
+		}, "ed", false},
+		{"clave RSA con JWT_ALG=EdDSA", "EdDSA", "", func(t *testing.T, dir string) {
+			writePrivateKey(t, dir, "rsa", testRSAKey)
+		}, "", true},
+		{"archivo sin PEM", "RS256", "", func(t *testing.T, dir string) {
+			if err := os.WriteFile(filepath.Join(dir, "rota.pem"), []byte("no es PEM"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+
+			err := loadTestKeys(t, config.Config{JWTAlgorithm: tt.alg, JWTKeysDir: dir, JWTActiveKID: tt.activeKID})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeys: error %v, se esperaba error: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if Keys.active.kid != tt.wantActive || Keys.active.sign == nil {
+				t.Errorf("clave activa %q (privada: %v), se esperaba la clave privada %q", Keys.active.kid, Keys.active.sign != nil, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	// Antes de la rotación solo existe la clave "anterior"
+	before := t.TempDir()
+	writePrivateKey(t, before, "anterior", testOtherRSA)
+	if err := loadTestKeys(t, config.Config{JWTAlgorithm: "RS256", JWTKeysDir: before}); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := Keys.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tras la rotación, "nueva" firma y "anterior" solo verifica
+	after := t.TempDir()
+	writePrivateKey(t, after, "nueva", testRSAKey)
+	writePublicKey(t, after, "anterior", &testOtherRSA.PublicKey)
+	if err := LoadKeys(config.Config{JWTAlgorithm: "RS256", JWTKeysDir: after, JWTActiveKID: "nueva"}); err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := Keys.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Un token firmado por "anterior" que declara el kid de "nueva"
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+	forged.Header["kid"] = "nueva"
+	forgedToken, err := forged.SignedString(testOtherRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+	unknown.Header["kid"] = "desconocida"
+	unknownToken, err := unknown.SignedString(testRSAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantKID string
+		wantErr bool
+	}{
+		{"token anterior a la rotación", oldToken, "anterior", false},
+		{"token nuevo", newToken, "nueva", false},
+		{"firma de otra clave", forgedToken, "nueva", true},
+		{"kid desconocido", unknownToken, "desconocida", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := Keys.Parse(tt.token, &jwt.RegisteredClaims{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse: error %v, se esperaba error: %v", err, tt.wantErr)
+			}
+			if token.Header["kid"] != tt.wantKID {
+				t.Errorf("kid = %v, se esperaba %q", token.Header["kid"], tt.wantKID)
+			}
+		})
+	}
+}
+
+func TestParseRejectsAlgorithmMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "rsa", testRSAKey)
+	writePublicKey(t, dir, "ed", testEd25519.Public())
+	if err := loadTestKeys(t, config.Config{JWTAlgorithm: "RS256", JWTKeysDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&testRSAKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		token := jwt.NewWithClaims(method, testClaims())
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		// Confusión de algoritmos: la clave pública RSA usada como secreto HMAC
+		{"HS256 con la clave pública RSA", sign(jwt.SigningMethodHS256, "rsa", publicPEM)},
+		{"HS256 con el módulo RSA", sign(jwt.SigningMethodHS256, "rsa", testRSAKey.N.Bytes())},
+		{"EdDSA con el kid de una clave RSA", sign(jwt.SigningMethodEdDSA, "rsa", testEd25519)},
+		{"RS256 con el kid de una clave Ed25519", sign(jwt.SigningMethodRS256, "ed", testRSAKey)},
+		{"alg none", sign(jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Keys.Parse(tt.token, &jwt.RegisteredClaims{}); err == nil {
+				t.Error("Parse aceptó el token")
+			}
+		})
+	}
+
+	// Con HS256, un token RS256 sin kid tampoco se acepta
+	if err := LoadKeys(config.Config{JWTAlgorithm: "HS256", JWTSecret: "secreto"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Keys.Parse(sign(jwt.SigningMethodRS256, "", testRSAKey), &jwt.RegisteredClaims{}); err == nil {
+		t.Error("Parse aceptó un token RS256 con JWT_ALG=HS256")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "b-rsa", testRSAKey)
+	writePublicKey(t, dir, "a-ed", testEd25519.Public())
+	if err := loadTestKeys(t, config.Config{JWTAlgorithm: "RS256", JWTKeysDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	set := Keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("%d claves publicadas, se esperaban 2", len(set.Keys))
+	}
+
+	// Ordenadas por kid
+	ed, rsaJWK := set.Keys[0], set.Keys[1]
+	if ed.Kid != "a-ed" || ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" || ed.N != "" {
+		t.Errorf("JWK Ed25519 = %+v", ed)
+	}
+	if x, err := base64.RawURLEncoding.DecodeString(ed.X); err != nil || !testEd25519.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+		t.Errorf("x = %q no es la clave pública Ed25519", ed.X)
+	}
+
+	if rsaJWK.Kid != "b-rsa" || rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.Use != "sig" || rsaJWK.X != "" {
+		t.Errorf("JWK RSA = %+v", rsaJWK)
+	}
+	n, errN := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	e, errE := base64.RawURLEncoding.DecodeString(rsaJWK.E)
+	if errN != nil || errE != nil || new(big.Int).SetBytes(n).Cmp(testRSAKey.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(testRSAKey.E) {
+		t.Errorf("n y e = %q, %q no son la clave pública RSA", rsaJWK.N, rsaJWK.E)
+	}
+	if rsaJWK.E != "AQAB" {
+		t.Errorf("e = %q, se esperaba AQAB (65537)", rsaJWK.E)
+	}
+
+	// Las claves HMAC no se publican
+	if err := LoadKeys(config.Config{JWTAlgorithm: "HS256", JWTSecret: "secreto"}); err != nil {
+		t.Fatal(err)
+	}
+	if keys := Keys.JWKS().Keys; keys == nil || len(keys) != 0 {
+		t.Errorf("JWKS con HS256 = %v, se esperaba una lista vacía", keys)
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"auth/db"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+// RevocationStore guarda los identificadores (jti) de los tokens de acceso
+// revocados y los de las sesiones cerradas (claim sid). La tabla revoked_tokens es la fuente de verdad y el mapa en
+// memoria evita consultar la base de datos en cada solicitud; se sincroniza
+// periódicamente para ver las revocaciones hechas por otras réplicas.
+type RevocationStore struct {
+	db      *sql.DB
+	mu      sync.RWMutex
+	revoked map[string]time.Time // jti -> expiración del token
+}
+
+// Revocations es el almacén de revocaciones usado por AuthMiddleware
+var Revocations *RevocationStore
+
+// InitRevocationStore carga las revocaciones vigentes e inicia la sincronización periódica
+func InitRevocationStore(database *sql.DB, syncInterval time.Duration) error {
+	store := &RevocationStore{
+		db:      database,
+		revoked: make(map[string]time.Time),
+	}
+
+	if err := store.sync(); err != nil {
+		return err
+	}
+
+	Revocations = store
+	go store.run(syncInterval)
+
+	return nil
+}
+
+// Revoke revoca un token hasta su expiración natural. Revocar un token ya
+// revocado, aquí o en otra réplica, no es un error.
+func (s *RevocationStore) Revoke(jti string, userID int, expiresAt time.Time) error {
+	if s.IsRevoked(jti) {
+		return nil
+	}
+
+	insert := "INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES (?, ?, ?) ON CONFLICT (jti) DO NOTHING"
+	if db.Dialect() == "mysql" {
+		insert = "INSERT IGNORE INTO revoked_tokens (jti, user_id, expires_at) VALUES (?, ?, ?)"
+	}
+	_, err := s.db.Exec(insert, jti, userID, expiresAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revoked[jti] = expiresAt
+	s.mu.Unlock()
+
+	return nil
+}
+
+// IsRevoked indica si el token con el jti dado fue revocado
+func (s *RevocationStore) IsRevoked(jti string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, revoked := s.revoked[jti]
+	return revoked
+}
+
+// run sincroniza y depura el almacén cada intervalo
+func (s *RevocationStore) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.prune(); err != nil {
+			log.Printf("Error al depurar tokens revocados: %v", err)
+		}
+		if err := s.sync(); err != nil {
+			log.Printf("Error al sincronizar tokens revocados: %v", err)
+		}
+	}
+}
+
+// sync agrega a la caché las revocaciones aún no expiradas. No la reemplaza,
+// para no perder las que Revoke agregue mientras tanto; las expiradas se
+// eliminan en prune.
+func (s *RevocationStore) sync() error {
+	rows, err := s.db.Query("SELECT jti, expires_at FROM revoked_tokens WHERE expires_at > ?", time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	revoked := make(map[string]time.Time)
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			return err
+		}
+		revoked[jti] = expiresAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for jti, expiresAt := range revoked {
+		s.revoked[jti] = expiresAt
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// prune elimina las revocaciones de tokens que ya expiraron, pues esos
+// tokens serían rechazados de todos modos por su fecha de expiración
+func (s *RevocationStore) prune() error {
+	now := time.Now()
+	if _, err := s.db.Exec("DELETE FROM revoked_tokens WHERE expires_at <= ?", now.UTC()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for jti, expiresAt := range s.revoked {
+		if !expiresAt.After(now) {
+			delete(s.revoked, jti)
+		}
+	}
+	s.mu.Unlock()
+
+	return nil
+}
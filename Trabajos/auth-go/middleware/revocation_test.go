@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"auth/config"
+	"auth/db"
+	"testing"
+	"time"
+)
+
+// newTestRevocationStore abre una base de datos SQLite en memoria con las
+// migraciones aplicadas y devuelve dos almacenes sobre ella, como dos réplicas
+func newTestRevocationStore(t *testing.T) (*RevocationStore, *RevocationStore) {
+	t.Helper()
+
+	if err := db.Connect(config.Config{DBDriver: "memory"}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { db.Database.Close() })
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+
+	newStore := func() *RevocationStore {
+		return &RevocationStore{db: db.Database, revoked: make(map[string]time.Time)}
+	}
+	return newStore(), newStore()
+}
+
+func TestRevokeTwice(t *testing.T) {
+	first, second := newTestRevocationStore(t)
+	expiresAt := time.Now().Add(time.Hour)
+
+	// Las dos réplicas revocan el mismo token antes de sincronizarse
+	tests := []struct {
+		name  string
+		store *RevocationStore
+	}{
+		{"primera revocación", first},
+		{"misma réplica", first},
+		{"otra réplica sin sincronizar", second},
+	}
+	for _, tt := range tests {
+		if err := tt.store.Revoke("jti-1", 1, expiresAt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.store.IsRevoked("jti-1") {
+			t.Errorf("%s: el token no figura como revocado", tt.name)
+		}
+	}
+
+	var count int
+	if err := db.Database.QueryRow("SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?", "jti-1").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d filas para el token, se esperaba 1", count)
+	}
+}
+
+func TestRevocationSync(t *testing.T) {
+	first, second := newTestRevocationStore(t)
+	now := time.Now()
+
+	if err := first.Revoke("jti-1", 1, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if second.IsRevoked("jti-1") {
+		t.Fatal("la otra réplica ve la revocación antes de sincronizar")
+	}
+
+	// Una revocación que Revoke agregó a la caché mientras sync leía la tabla
+	second.mu.Lock()
+	second.revoked["jti-concurrente"] = now.Add(time.Hour)
+	second.mu.Unlock()
+
+	if err := second.sync(); err != nil {
+		t.Fatal(err)
+	}
+	for _, jti := range []string{"jti-1", "jti-concurrente"} {
+		if !second.IsRevoked(jti) {
+			t.Errorf("%s: no figura como revocado tras sincronizar", jti)
+		}
+	}
+}
+
+func TestRevocationPrune(t *testing.T) {
+	store, _ := newTestRevocationStore(t)
+	now := time.Now()
+
+	if err := store.Revoke("expirado", 1, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke("vigente", 1, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		jti         string
+		wantRevoked bool
+		wantRows    int
+	}{
+		{"expirado", false, 0},
+		{"vigente", true, 1},
+	}
+	for _, tt := range tests {
+		var rows int
+		if err := db.Database.QueryRow("SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?", tt.jti).Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+		if store.IsRevoked(tt.jti) != tt.wantRevoked || rows != tt.wantRows {
+			t.Errorf("%s: revocado %v con %d filas, se esperaba %v con %d", tt.jti, store.IsRevoked(tt.jti), rows, tt.wantRevoked, tt.wantRows)
+		}
+	}
+}
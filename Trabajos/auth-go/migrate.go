@@ -0,0 +1,87 @@
+package main
+
+import (
+	"auth/config"
+	"auth/db"
+	"fmt"
+	"strconv"
+)
+
+// runMigrate ejecuta el subcomando migrate:
+//
+//	auth-service migrate [up]        aplica las migraciones pendientes
+//	auth-service migrate down [n]    revierte las últimas n migraciones (1 por defecto)
+//	auth-service migrate status      muestra qué migraciones están aplicadas
+//	auth-service migrate identities  normaliza los nombres de usuario y correos e informa las colisiones
+func runMigrate(cfg config.Config, args []string) error {
+	if err := db.Connect(cfg); err != nil {
+		return err
+	}
+	defer db.Database.Close()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		if len(args) > 1 {
+			return fmt.Errorf("uso: migrate up")
+		}
+		applied, err := db.MigrateUp()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migraciones aplicadas\n", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 2 {
+			return fmt.Errorf("uso: migrate down [n]")
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("número de migraciones inválido: %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := db.MigrateDown(steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migraciones revertidas\n", reverted)
+
+	case "status":
+		status, err := db.MigrationsStatus()
+		if err != nil {
+			return err
+		}
+		for _, migration := range status {
+			state := "pendiente"
+			if migration.AppliedAt.Valid {
+				state = "aplicada " + migration.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", migration.Version, migration.Name, state)
+		}
+
+	case "identities":
+		changed, collisions, err := db.NormalizeIdentities()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d valores normalizados\n", changed)
+		for _, collision := range collisions {
+			fmt.Printf("colisión: %s\n", collision)
+		}
+		if len(collisions) > 0 {
+			return fmt.Errorf("%d colisiones sin resolver", len(collisions))
+		}
+
+	default:
+		return fmt.Errorf("subcomando desconocido %q (usa up, down, status o identities)", command)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// APIKey representa una clave de API de larga duración para automatizaciones
+type APIKey struct {
+	ID         int          `json:"id"`
+	UserID     int          `json:"user_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"` // Inicio visible de la clave, para identificarla
+	Role       string       `json:"role"`   // Igual o inferior al rol del usuario
+	ExpiresAt  sql.NullTime `json:"-"`
+	LastUsedAt sql.NullTime `json:"-"`
+	RevokedAt  sql.NullTime `json:"-"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// IsActive indica si la clave puede usarse
+func (k APIKey) IsActive(now time.Time) bool {
+	return !k.RevokedAt.Valid && (!k.ExpiresAt.Valid || now.Before(k.ExpiresAt.Time))
+}
+
+// CreateAPIKeyRequest representa la solicitud de creación de una clave de API.
+// Si no se indica rol, la clave tiene el rol "user".
+type CreateAPIKeyRequest struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	Role          string `json:"role"`
+	ExpiresInDays int    `json:"expires_in_days" binding:"omitempty,min=1,max=3650"`
+}
+
+// APIKeyResponse representa una clave de API con sus fechas y estado
+type APIKeyResponse struct {
+	APIKey
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Status     string     `json:"status"` // active, revoked o expired
+}
+
+// CreateAPIKeyResponse devuelve la clave completa, que solo se muestra una vez
+type CreateAPIKeyResponse struct {
+	Key    string         `json:"key"`
+	APIKey APIKeyResponse `json:"api_key"`
+}
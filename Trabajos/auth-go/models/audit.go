@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// Tipos de eventos de auditoría
+const (
+	AuditRegister                 = "register"
+	AuditLogin                    = "login"
+	AuditLoginMFA                 = "login_mfa"
+	AuditMagicLinkLogin           = "magic_link_login"
+	AuditLogout                   = "logout"
+	AuditRefreshReuse             = "refresh_token_reuse"
+	AuditPasswordReset            = "password_reset"
+	AuditPasswordChanged          = "password_changed"
+	AuditProfileUpdated           = "profile_updated"
+	AuditAccountDeletionRequested = "account_deletion_requested"
+	AuditAccountDeletionCancelled = "account_deletion_cancelled"
+	AuditAccountExported          = "account_exported"
+	AuditEmailVerified            = "email_verified"
+	AuditEmailChangeRequested     = "email_change_requested"
+	AuditEmailChanged             = "email_changed"
+	AuditEmailChangeUndone        = "email_change_undone"
+	AuditTOTPEnabled              = "totp_enabled"
+	AuditTOTPDisabled             = "totp_disabled"
+	AuditAPIKeyCreated            = "api_key_created"
+	AuditAPIKeyRevoked            = "api_key_revoked"
+	AuditSessionRevoked           = "session_revoked"
+	AuditOIDCLogin                = "oidc_login"
+	AuditRoleChanged              = "role_changed"
+	AuditUserDisabled             = "user_disabled"
+	AuditUserEnabled              = "user_enabled"
+	AuditForcePasswordReset       = "force_password_reset"
+	AuditUserUnlocked             = "user_unlocked"
+	AuditUserDeleted              = "user_deleted"
+	AuditInvitationCreated        = "invitation_created"
+	AuditInvitationRevoked        = "invitation_revoked"
+	AuditOAuthClientCreated       = "oauth_client_created"
+	AuditOAuthClientDeleted       = "oauth_client_deleted"
+	AuditRoleUpdated              = "rbac_role_updated"
+	AuditPermissionUpdated        = "rbac_permission_updated"
+)
+
+// Resultados de un evento de auditoría
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent representa un evento del registro de auditoría. Los eventos no
+// se modifican: solo se agregan y se eliminan al superar la retención.
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	EventType string    `json:"event_type"`
+	Outcome   string    `json:"outcome"`
+	ActorID   int       `json:"actor_id,omitempty"`   // Usuario que realizó la acción (0 si es anónimo)
+	ActorName string    `json:"actor_name,omitempty"` // Nombre de usuario indicado, aunque no exista
+	TargetID  int       `json:"target_id,omitempty"`  // Usuario afectado por la acción
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditFilter contiene los filtros del listado de eventos de auditoría
+type AuditFilter struct {
+	EventType string
+	Outcome   string
+	ActorID   int
+	TargetID  int
+	IP        string
+	From      time.Time
+	To        time.Time
+}
+
+// AuditEventListResponse representa una página del registro de auditoría
+type AuditEventListResponse struct {
+	Events   []AuditEvent `json:"events"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+	Total    int          `json:"total"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Formatos de exportación de los datos de una cuenta
+const (
+	ExportFormatJSON = "json"
+	ExportFormatZIP  = "zip"
+)
+
+// AccountExport reúne los datos personales guardados de un usuario
+type AccountExport struct {
+	ExportedAt  time.Time        `json:"exported_at"`
+	User        User             `json:"user"`
+	Sessions    []SessionExport  `json:"sessions"`
+	APIKeys     []APIKeyResponse `json:"api_keys"`
+	AuditEvents []AuditEvent     `json:"audit_events"`
+}
+
+// SessionExport representa una sesión exportada, incluida su revocación
+type SessionExport struct {
+	Session
+	RevokedAt *time.Time `json:"revoked_at"`
+}
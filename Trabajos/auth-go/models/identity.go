@@ -0,0 +1,21 @@
+package models
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeUsername devuelve la forma con la que se guarda y se busca un
+// nombre de usuario: sin espacios en los extremos y en Unicode NFKC, para que
+// variantes como los caracteres de ancho completo no creen nombres distintos
+// que se ven iguales.
+func NormalizeUsername(username string) string {
+	return norm.NFKC.String(strings.TrimSpace(username))
+}
+
+// NormalizeEmail devuelve la forma con la que se guarda y se busca un correo:
+// sin espacios en los extremos y en minúsculas
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,51 @@
+package models
+
+import "testing"
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"sin cambios", "maria", "maria"},
+		{"conserva las mayúsculas", "Maria", "Maria"},
+		{"espacios en los extremos", "  maria\t", "maria"},
+		{"ancho completo", "ｍａｒｉａ", "maria"},
+		{"ligadura", "ﬁlo", "filo"},
+		{"superíndice", "ana²", "ana2"},
+		{"acento combinado", "Jose\u0301", "José"},
+		{"acento precompuesto", "José", "José"},
+		{"espacio interior", "ana maria", "ana maria"},
+		{"vacío", "   ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeUsername(tt.value); got != tt.want {
+				t.Errorf("NormalizeUsername(%q) = %q, se esperaba %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"sin cambios", "maria@example.com", "maria@example.com"},
+		{"mayúsculas", "Maria@Example.COM", "maria@example.com"},
+		{"espacios en los extremos", " maria@example.com\n", "maria@example.com"},
+		{"vacío", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeEmail(tt.value); got != tt.want {
+				t.Errorf("NormalizeEmail(%q) = %q, se esperaba %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Invitation representa un código de invitación de un solo uso que otorga un rol
+type Invitation struct {
+	ID        int          `json:"id"`
+	Role      string       `json:"role"`
+	Email     string       `json:"email,omitempty"` // Si se indica, solo ese correo puede usar la invitación
+	CreatedBy int          `json:"created_by"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"-"`
+	UsedBy    int          `json:"used_by,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// IsUsable indica si la invitación todavía puede utilizarse
+func (i Invitation) IsUsable(now time.Time) bool {
+	return !i.UsedAt.Valid && now.Before(i.ExpiresAt)
+}
+
+// CreateInvitationRequest representa la solicitud de creación de una invitación
+type CreateInvitationRequest struct {
+	Role           string `json:"role" binding:"required"`
+	Email          string `json:"email" binding:"omitempty,email"`
+	ExpiresInHours int    `json:"expires_in_hours" binding:"omitempty,min=1,max=720"`
+}
+
+// InvitationResponse representa una invitación con su estado
+type InvitationResponse struct {
+	Invitation
+	Status string `json:"status"` // pending, used o expired
+}
+
+// CreateInvitationResponse devuelve el código de la invitación, que solo se muestra una vez
+type CreateInvitationResponse struct {
+	Code       string     `json:"code"`
+	Invitation Invitation `json:"invitation"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// TOTPEnrollRequest representa la solicitud de activación de TOTP, que exige
+// la contraseña actual para que un token robado no baste para vincular un segundo factor
+type TOTPEnrollRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// TOTPEnrollResponse devuelve el secreto TOTP y la URI para las aplicaciones de autenticación
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TOTPCodeRequest representa una solicitud que incluye un código TOTP o de recuperación
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse devuelve los códigos de recuperación, que solo se muestran una vez
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAChallengeResponse es la respuesta de Login cuando el usuario tiene TOTP activo
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// MFALoginRequest representa el segundo paso del inicio de sesión
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
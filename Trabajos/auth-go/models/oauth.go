@@ -0,0 +1,93 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// OAuthClient representa un cliente OAuth2 (por ejemplo, otro microservicio)
+type OAuthClient struct {
+	ID           int       `json:"id"`
+	ClientID     string    `json:"client_id"`
+	SecretHash   string    `json:"-"`
+	Name         string    `json:"name"`
+	Scopes       []string  `json:"scopes"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Public       bool      `json:"public"` // Cliente sin secreto (aplicación web o móvil), solo con PKCE
+	Disabled     bool      `json:"disabled"`
+	CreatedBy    int       `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// HasScope indica si el cliente tiene permitido el scope
+func (c OAuthClient) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRedirectURI indica si la URI de redirección está registrada (comparación exacta)
+func (c OAuthClient) HasRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// scopePattern limita los scopes a identificadores simples como "reservas:read"
+var scopePattern = regexp.MustCompile(`^[a-z0-9_.:-]{1,64}$`)
+
+// IsValidScope indica si el nombre del scope es válido
+func IsValidScope(scope string) bool {
+	return scopePattern.MatchString(scope)
+}
+
+// CreateOAuthClientRequest representa la solicitud de registro de un cliente OAuth.
+// Los clientes que usan el flujo de código de autorización (OIDC) deben indicar
+// sus URIs de redirección.
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Public       bool     `json:"public"`
+}
+
+// CreateOAuthClientResponse devuelve el secreto del cliente, que solo se muestra
+// una vez. Los clientes públicos no tienen secreto.
+type CreateOAuthClientResponse struct {
+	ClientID     string      `json:"client_id"`
+	ClientSecret string      `json:"client_secret,omitempty"`
+	Client       OAuthClient `json:"client"`
+}
+
+// OAuthTokenRequest representa la solicitud al endpoint de tokens (RFC 6749).
+// Las credenciales del cliente también pueden enviarse con HTTP Basic.
+type OAuthTokenRequest struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Code         string `form:"code"`          // authorization_code
+	RedirectURI  string `form:"redirect_uri"`  // authorization_code
+	CodeVerifier string `form:"code_verifier"` // authorization_code (PKCE)
+}
+
+// OAuthTokenResponse representa un token emitido por el endpoint de tokens
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// OAuthError representa un error con el formato de RFC 6749
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
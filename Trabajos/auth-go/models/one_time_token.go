@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// OneTimeToken representa un token de un solo uso enviado al usuario
+// (restablecimiento de contraseña, verificación de correo, etc.)
+type OneTimeToken struct {
+	ID        int
+	UserID    int
+	Purpose   string
+	Data      string // Información adicional según el propósito
+	ExpiresAt time.Time
+}
+
+// ForgotPasswordRequest representa la solicitud de restablecimiento de contraseña
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// MagicLinkRequest representa la solicitud de un enlace de inicio de sesión sin contraseña
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest representa el cambio de contraseña con un token de restablecimiento
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"` // Validada con la política de contraseñas
+}
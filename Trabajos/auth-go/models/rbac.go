@@ -0,0 +1,81 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// Permisos incluidos en el servicio. El rol admin siempre los tiene todos.
+const (
+	PermUsersRead    = "users:read"
+	PermUsersWrite   = "users:write"
+	PermInvitations  = "invitations:manage"
+	PermOAuthClients = "oauth_clients:manage"
+	PermRoles        = "roles:manage"
+	PermAuditRead    = "audit:read"
+)
+
+// BuiltinPermissions son los permisos que se crean al iniciar el servicio
+var BuiltinPermissions = map[string]string{
+	PermUsersRead:    "Consultar usuarios",
+	PermUsersWrite:   "Modificar, deshabilitar y eliminar usuarios",
+	PermInvitations:  "Crear y revocar invitaciones",
+	PermOAuthClients: "Registrar y eliminar clientes OAuth",
+	PermRoles:        "Administrar roles y permisos",
+	PermAuditRead:    "Consultar el registro de auditoría",
+}
+
+// Role representa un rol con los permisos que otorga
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Builtin     bool      `json:"builtin"` // Los roles incluidos no pueden eliminarse
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Permission representa un permiso que puede asignarse a los roles
+type Permission struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Builtin     bool   `json:"builtin"`
+}
+
+// namePattern limita los nombres de roles y permisos a identificadores como "books:write"
+var namePattern = regexp.MustCompile(`^[a-z0-9_.:-]{1,50}$`)
+
+// maxRoleNameLength es el tamaño de las columnas users.role, invitations.role y api_keys.role
+const maxRoleNameLength = 20
+
+// IsValidRBACName indica si el nombre de un rol o permiso es válido
+func IsValidRBACName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// IsValidRoleName indica si el nombre de un rol es válido. Es más corto que
+// el de un permiso porque se guarda en las columnas de rol de otras tablas.
+func IsValidRoleName(name string) bool {
+	return len(name) <= maxRoleNameLength && IsValidRBACName(name)
+}
+
+// CreateRoleRequest representa la solicitud de creación de un rol
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRolePermissionsRequest representa la modificación de un rol; los
+// permisos indicados reemplazan a los actuales
+type UpdateRolePermissionsRequest struct {
+	Description *string  `json:"description" binding:"omitempty,max=255"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// CreatePermissionRequest representa la solicitud de creación de un permiso
+type CreatePermissionRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description" binding:"max=255"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRBACNames(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		wantPermission bool
+		wantRole       bool
+	}{
+		{"identificador simple", "editor", true, true},
+		{"con recurso y acción", "books:write", true, true},
+		{"con puntos y guiones", "app.v2_lector-x", true, true},
+		{"vacío", "", false, false},
+		{"mayúsculas", "Editor", false, false},
+		{"espacios", "books write", false, false},
+		{"acentos", "edición", false, false},
+		{"20 caracteres", strings.Repeat("a", 20), true, true},
+		{"21 caracteres", strings.Repeat("a", 21), true, false},
+		{"50 caracteres", strings.Repeat("a", 50), true, false},
+		{"51 caracteres", strings.Repeat("a", 51), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidRBACName(tt.value); got != tt.wantPermission {
+				t.Errorf("IsValidRBACName(%q) = %v, se esperaba %v", tt.value, got, tt.wantPermission)
+			}
+			if got := IsValidRoleName(tt.value); got != tt.wantRole {
+				t.Errorf("IsValidRoleName(%q) = %v, se esperaba %v", tt.value, got, tt.wantRole)
+			}
+		})
+	}
+}
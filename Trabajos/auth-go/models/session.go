@@ -0,0 +1,24 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Session representa un inicio de sesión en un dispositivo. Su ID es el de la
+// familia de tokens de renovación y viaja en el claim "sid" de los tokens de acceso.
+type Session struct {
+	ID         string       `json:"id"`
+	UserID     int          `json:"-"`
+	UserAgent  string       `json:"user_agent"`
+	IP         string       `json:"ip"` // IP de la última actividad
+	CreatedAt  time.Time    `json:"created_at"`
+	LastSeenAt time.Time    `json:"last_seen_at"`
+	RevokedAt  sql.NullTime `json:"-"`
+}
+
+// SessionResponse representa una sesión e indica si es la de la solicitud actual
+type SessionResponse struct {
+	Session
+	Current bool `json:"current"`
+}
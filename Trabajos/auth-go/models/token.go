@@ -0,0 +1,28 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RefreshToken representa un token de renovación almacenado (solo su hash)
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	FamilyID  string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	RevokedAt sql.NullTime
+	CreatedAt time.Time
+}
+
+// RefreshRequest representa la solicitud de renovación de tokens
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest representa la solicitud de cierre de sesión. El token de
+// renovación es opcional; si se envía, también se revoca su familia.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
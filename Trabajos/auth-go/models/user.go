@@ -1,50 +1,144 @@
 package models
 
 import (
+	"auth/security"
+	"strings"
 	"time"
 )
 
 // User representa un usuario en el sistema
 type User struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` // El guión evita que se muestre en las respuestas JSON
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                int    `json:"id"`
+	Username          string `json:"username"`
+	Email             string `json:"email"`
+	PendingEmail      string `json:"pending_email,omitempty"` // Correo nuevo pendiente de confirmar
+	Password          string `json:"-"`                       // El guión evita que se muestre en las respuestas JSON
+	Role              string `json:"role"`
+	EmailVerified     bool   `json:"email_verified"`
+	TOTPEnabled       bool   `json:"totp_enabled"`
+	Disabled          bool   `json:"disabled"`            // Impide iniciar sesión y usar tokens ya emitidos
+	MustResetPassword bool   `json:"must_reset_password"` // Obliga a restablecer la contraseña antes de iniciar sesión
+	// Fecha a partir de la cual la cuenta se elimina definitivamente, si el usuario pidió eliminarla
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
+// Roles incluidos en el servicio; pueden crearse otros desde la API de administración
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // RegisterRequest representa la solicitud de registro de usuario
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
-	Role     string `json:"role"`
+	Email    string `json:"email" binding:"required"`    // Se valida después de normalizarlo
+	Password string `json:"password" binding:"required"` // Validada con la política de contraseñas
+	// Código de invitación opcional; otorga el rol indicado en la invitación
+	InviteCode string `json:"invite_code"`
 }
 
 // LoginRequest representa la solicitud de inicio de sesión
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Identifier string `json:"identifier"` // Nombre de usuario o correo electrónico
+	Username   string `json:"username"`   // Equivale a identifier; se mantiene por compatibilidad
+	Password   string `json:"password" binding:"required"`
+}
+
+// LoginIdentifier devuelve el identificador indicado, con prioridad para identifier
+func (r LoginRequest) LoginIdentifier() string {
+	if identifier := strings.TrimSpace(r.Identifier); identifier != "" {
+		return identifier
+	}
+	return strings.TrimSpace(r.Username)
 }
 
 // TokenResponse representa la respuesta con el token JWT
 type TokenResponse struct {
-	Token     string       `json:"token"`
-	ExpiresAt string       `json:"expires_at"`
-	User      UserResponse `json:"user"`
+	Token            string       `json:"token"`
+	ExpiresAt        string       `json:"expires_at"`
+	RefreshToken     string       `json:"refresh_token"`
+	RefreshExpiresAt string       `json:"refresh_expires_at"`
+	User             UserResponse `json:"user"`
 }
 
 // UserResponse representa la información del usuario que se devolverá
 type UserResponse struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Role     string `json:"role"`
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+	PendingEmail  string `json:"pending_email,omitempty"`
+}
+
+// PendingVerificationResponse representa un registro que aún debe verificar su correo
+type PendingVerificationResponse struct {
+	Message string       `json:"message"`
+	User    UserResponse `json:"user"`
+}
+
+// ResendVerificationRequest representa la solicitud de reenvío del correo de verificación
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// MessageResponse representa una respuesta con un mensaje informativo
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// UserListResponse representa una página del listado de usuarios
+type UserListResponse struct {
+	Users    []User `json:"users"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+	Total    int    `json:"total"`
+}
+
+// UpdateRoleRequest representa la solicitud de cambio de rol
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"`
 }
 
 // ResponseError representa un mensaje de error
 type ResponseError struct {
 	Error string `json:"error"`
 }
+
+// UpdateProfileRequest representa el cambio de los datos del perfil. El
+// correo se cambia con ChangeEmailRequest, que debe confirmarse.
+type UpdateProfileRequest struct {
+	Username string `json:"username" binding:"required,max=50"`
+}
+
+// ChangeEmailRequest representa la solicitud de cambio de correo electrónico
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required"` // Se valida después de normalizarlo
+	Password string `json:"password" binding:"required"`
+}
+
+// ChangePasswordRequest representa el cambio de contraseña del usuario autenticado
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"` // Validada con la política de contraseñas
+}
+
+// DeleteAccountRequest representa la solicitud de eliminación de la propia cuenta
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// AccountDeletionResponse indica cuándo se eliminará definitivamente la cuenta
+type AccountDeletionResponse struct {
+	Message     string    `json:"message"`
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+// PasswordPolicyError representa una contraseña rechazada por la política,
+// con una entrada por cada regla que no cumple
+type PasswordPolicyError struct {
+	Error      string                     `json:"error"`
+	Violations []security.PolicyViolation `json:"violations"`
+}
@@ -3,34 +3,121 @@ package routes
 import (
 	"auth/config"
 	"auth/controllers"
+	"auth/mailer"
 	"auth/middleware"
+	"auth/models"
+	"auth/security"
+	"auth/store"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes configura todas las rutas del API
-func SetupRoutes(router *gin.Engine, config config.Config) {
+func SetupRoutes(router *gin.Engine, config config.Config, mail mailer.Mailer, userStore store.UserStore, policy security.PasswordPolicy) {
 	// Crear instancia del controlador de autenticación
-	authController := controllers.NewAuthController(config)
+	authController := controllers.NewAuthController(config, mail, userStore, policy)
+	adminController := controllers.NewAdminController(config, userStore)
+	introspectionController := controllers.NewIntrospectionController(config)
+	oauthController := controllers.NewOAuthController(config, authController)
+
+	// Claves públicas para que otros servicios verifiquen los tokens
+	router.GET("/.well-known/jwks.json", controllers.JWKS)
+
+	// Endpoint de tokens OAuth2 (client_credentials y authorization_code)
+	router.POST("/oauth/token", oauthController.Token)
+
+	// Proveedor OpenID Connect. Los id_token deben poder verificarse con las
+	// claves publicadas, por lo que solo se habilita con firma asimétrica.
+	if config.JWTAlgorithm != "HS256" {
+		router.GET("/.well-known/openid-configuration", oauthController.OpenIDConfiguration)
+		router.GET("/oauth/authorize", oauthController.Authorize)
+		router.POST("/oauth/authorize", oauthController.AuthorizeSubmit)
+
+		userinfo := router.Group("/oauth/userinfo")
+		userinfo.Use(middleware.UserInfoAuthMiddleware(config), middleware.RequireUser(), middleware.ScopeMiddleware(models.ScopeOpenID))
+		{
+			userinfo.GET("", oauthController.UserInfo)
+			userinfo.POST("", oauthController.UserInfo)
+		}
+	}
 
 	// Grupo de rutas públicas (sin autenticación)
 	public := router.Group("/api/auth")
 	{
 		public.POST("/register", authController.Register)
 		public.POST("/login", authController.Login)
+		public.POST("/login/mfa", authController.LoginMFA)
+		public.POST("/refresh", authController.Refresh)
+		public.POST("/password/forgot", authController.ForgotPassword)
+		public.POST("/password/reset", authController.ResetPassword)
+		public.POST("/magic-link", authController.RequestMagicLink)
+		public.GET("/magic-link/consume", authController.ConsumeMagicLink)
+		public.GET("/verify", authController.VerifyEmail)
+		public.POST("/verify/resend", authController.ResendVerification)
+		public.GET("/email/confirm", authController.ConfirmEmailChange)
+		public.GET("/email/undo", authController.UndoEmailChange)
+
+		// Introspección para otros servicios (autenticados con HTTP Basic)
+		public.POST("/introspect", introspectionController.Introspect)
 	}
 
 	// Grupo de rutas protegidas (requieren autenticación)
 	protected := router.Group("/api/auth")
-	protected.Use(middleware.AuthMiddleware(config))
+	protected.Use(middleware.AuthMiddleware(config), middleware.RequireUser())
 	{
 		protected.GET("/profile", authController.GetProfile)
+		protected.PATCH("/profile", authController.UpdateProfile)
+		protected.POST("/email/change", authController.RequestEmailChange)
+		protected.POST("/password", authController.ChangePassword)
+		protected.DELETE("/account", authController.DeleteAccount)
+		protected.GET("/account/export", authController.ExportAccount)
+		protected.POST("/logout", authController.Logout)
+		protected.POST("/mfa/totp/enroll", authController.EnrollTOTP)
+		protected.POST("/mfa/totp/confirm", authController.ConfirmTOTP)
+		protected.DELETE("/mfa/totp", authController.DisableTOTP)
+		protected.POST("/api-keys", authController.CreateAPIKey)
+		protected.GET("/api-keys", authController.ListAPIKeys)
+		protected.DELETE("/api-keys/:id", authController.RevokeAPIKey)
+		protected.GET("/sessions", authController.ListSessions)
+		protected.DELETE("/sessions/:id", authController.RevokeSession)
 
-		// Rutas que requieren rol específico (ejemplo)
+		// Rutas de administración, cada grupo con el permiso que requiere
 		admin := protected.Group("/admin")
-		admin.Use(middleware.RoleMiddleware("admin"))
 		{
-			// Aquí irían rutas solo para administradores
+			users := admin.Group("", middleware.RequirePermission(models.PermUsersRead))
+			users.GET("/users", adminController.ListUsers)
+			users.GET("/users/:id", adminController.GetUser)
+			users.GET("/users/:id/export", adminController.ExportUser)
+
+			usersWrite := admin.Group("", middleware.RequirePermission(models.PermUsersWrite))
+			usersWrite.PUT("/users/:id/role", adminController.UpdateRole)
+			usersWrite.POST("/users/:id/disable", adminController.DisableUser)
+			usersWrite.POST("/users/:id/enable", adminController.EnableUser)
+			usersWrite.POST("/users/:id/force-password-reset", adminController.ForcePasswordReset)
+			usersWrite.POST("/users/:id/unlock", adminController.UnlockUser)
+			usersWrite.DELETE("/users/:id", adminController.DeleteUser)
+
+			invitations := admin.Group("", middleware.RequirePermission(models.PermInvitations))
+			invitations.POST("/invitations", adminController.CreateInvitation)
+			invitations.GET("/invitations", adminController.ListInvitations)
+			invitations.DELETE("/invitations/:id", adminController.RevokeInvitation)
+
+			oauthClients := admin.Group("", middleware.RequirePermission(models.PermOAuthClients))
+			oauthClients.POST("/oauth/clients", adminController.CreateOAuthClient)
+			oauthClients.GET("/oauth/clients", adminController.ListOAuthClients)
+			oauthClients.DELETE("/oauth/clients/:id", adminController.DeleteOAuthClient)
+
+			roles := admin.Group("", middleware.RequirePermission(models.PermRoles))
+			roles.GET("/roles", adminController.ListRoles)
+			roles.POST("/roles", adminController.CreateRole)
+			roles.PUT("/roles/:id", adminController.UpdateRolePermissions)
+			roles.DELETE("/roles/:id", adminController.DeleteRole)
+			roles.GET("/permissions", adminController.ListPermissions)
+			roles.POST("/permissions", adminController.CreatePermission)
+			roles.DELETE("/permissions/:id", adminController.DeletePermission)
+
+			auditLog := admin.Group("", middleware.RequirePermission(models.PermAuditRead))
+			auditLog.GET("/audit-events", adminController.ListAuditEvents)
 		}
 	}
 }
@@ -0,0 +1,1514 @@
+package routes
+
+import (
+	"archive/zip"
+	"auth/config"
+	"auth/controllers"
+	"auth/db"
+	"auth/mailer"
+	"auth/middleware"
+	"auth/models"
+	"auth/store"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestServer inicia el servicio con DB_DRIVER=memory y las variables de
+// entorno indicadas, igual que main, y devuelve el router
+func newTestServer(t *testing.T, env map[string]string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	// LoadConfig exige un archivo .env en el directorio actual
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	t.Setenv("DB_DRIVER", "memory")
+	t.Setenv("JWT_SECRET", "secreto-de-pruebas")
+	t.Setenv("MAIL_OUTBOX_DIR", filepath.Join(dir, "outbox"))
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if err := middleware.LoadKeys(cfg); err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+	if err := db.InitializeDB(cfg); err != nil {
+		t.Fatalf("InitializeDB: %v", err)
+	}
+	t.Cleanup(func() { db.Database.Close() })
+
+	users, err := store.New(cfg, db.Database)
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	middleware.Users = users
+	if err := middleware.InitRevocationStore(db.Database, cfg.RevocationSyncInterval); err != nil {
+		t.Fatalf("InitRevocationStore: %v", err)
+	}
+
+	policy, err := controllers.LoadPasswordPolicy(cfg)
+	if err != nil {
+		t.Fatalf("LoadPasswordPolicy: %v", err)
+	}
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		t.Fatalf("mailer.New: %v", err)
+	}
+
+	router := gin.New()
+	SetupRoutes(router, cfg, mail, users, policy)
+	return router
+}
+
+// doJSON envía una solicitud con cuerpo JSON y decodifica la respuesta en out
+func doJSON(t *testing.T, router *gin.Engine, method, path, token string, body, out any) int {
+	t.Helper()
+
+	authorization := ""
+	if token != "" {
+		authorization = "Bearer " + token
+	}
+	return doJSONWithAuthorization(t, router, method, path, authorization, body, out)
+}
+
+// doJSONWithAuthorization es doJSON con la cabecera Authorization completa
+func doJSONWithAuthorization(t *testing.T, router *gin.Engine, method, path, authorization string, body, out any) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if out != nil && rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: respuesta inválida %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// testPassword cumple la política de contraseñas por defecto
+const testPassword = "Correcta-Caballo-42"
+
+// registerAndLogin registra al usuario con el correo <username>@example.com
+// e inicia sesión con identifier
+func registerAndLogin(t *testing.T, router *gin.Engine, username, identifier string) models.TokenResponse {
+	t.Helper()
+
+	register := models.RegisterRequest{Username: username, Email: username + "@example.com", Password: testPassword}
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/register", "", register, nil); code != http.StatusCreated {
+		t.Fatalf("registro: código %d, se esperaba %d", code, http.StatusCreated)
+	}
+	return loginAs(t, router, identifier)
+}
+
+// loginAs inicia sesión con identifier y testPassword
+func loginAs(t *testing.T, router *gin.Engine, identifier string) models.TokenResponse {
+	t.Helper()
+
+	var login models.TokenResponse
+	body := models.LoginRequest{Identifier: identifier, Password: testPassword}
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/login", "", body, &login); code != http.StatusOK {
+		t.Fatalf("inicio de sesión: código %d, se esperaba %d", code, http.StatusOK)
+	}
+	if login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("inicio de sesión sin tokens: %+v", login)
+	}
+	return login
+}
+
+func TestMemoryDriverRegisterAndLogin(t *testing.T) {
+	tests := []struct {
+		name        string
+		autoMigrate string
+		identifier  string
+	}{
+		{"migración automática, nombre de usuario", "true", "maria"},
+		{"sin migración automática, nombre de usuario", "false", "maria"},
+		{"correo con mayúsculas y espacios", "true", "  Maria@Example.com "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestServer(t, map[string]string{"DB_AUTO_MIGRATE": tt.autoMigrate})
+
+			login := registerAndLogin(t, router, "maria", tt.identifier)
+
+			var profile models.UserResponse
+			if code := doJSON(t, router, http.MethodGet, "/api/auth/profile", login.Token, nil, &profile); code != http.StatusOK {
+				t.Fatalf("perfil: código %d, se esperaba %d", code, http.StatusOK)
+			}
+			if profile.Username != "maria" || profile.Email != "maria@example.com" {
+				t.Errorf("perfil = %+v", profile)
+			}
+		})
+	}
+}
+
+func TestForcePasswordReset(t *testing.T) {
+	router := newTestServer(t, nil)
+
+	admin := registerAndLogin(t, router, "admin1", "admin1")
+	if err := middleware.Users.UpdateRole(admin.User.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := loginAs(t, router, "admin1").Token
+	maria := registerAndLogin(t, router, "maria", "maria")
+
+	path := "/api/auth/admin/users/" + strconv.Itoa(maria.User.ID) + "/force-password-reset"
+	if code := doJSON(t, router, http.MethodPost, path, adminToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("obligar a restablecer la contraseña: código %d", code)
+	}
+
+	const newPassword = "Otra-Clave-Segura-7"
+	login := func(password string) int {
+		return doJSON(t, router, http.MethodPost, "/api/auth/login", "", models.LoginRequest{Identifier: "maria", Password: password}, nil)
+	}
+	clearOutbox(t)
+
+	// Los pasos dependen de los anteriores y se ejecutan en orden
+	steps := []struct {
+		name string
+		run  func() int
+		want int
+	}{
+		{"las sesiones se cierran", func() int {
+			return doJSON(t, router, http.MethodGet, "/api/auth/profile", maria.Token, nil, nil)
+		}, http.StatusUnauthorized},
+		{"el cambio de contraseña con el token anterior se rechaza", func() int {
+			body := models.ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: newPassword}
+			return doJSON(t, router, http.MethodPost, "/api/auth/password", maria.Token, body, nil)
+		}, http.StatusUnauthorized},
+		{"el inicio de sesión se rechaza", func() int { return login(testPassword) }, http.StatusForbidden},
+		{"solicitar el enlace de restablecimiento", func() int {
+			return doJSON(t, router, http.MethodPost, "/api/auth/password/forgot", "", models.ForgotPasswordRequest{Email: "maria@example.com"}, nil)
+		}, http.StatusOK},
+		{"restablecer la contraseña", func() int {
+			body := models.ResetPasswordRequest{Token: mailToken(t, "maria@example.com", "/reset-password"), Password: newPassword}
+			return doJSON(t, router, http.MethodPost, "/api/auth/password/reset", "", body, nil)
+		}, http.StatusOK},
+		{"la contraseña anterior ya no sirve", func() int { return login(testPassword) }, http.StatusUnauthorized},
+		{"inicio de sesión con la nueva contraseña", func() int { return login(newPassword) }, http.StatusOK},
+	}
+
+	for _, step := range steps {
+		if code := step.run(); code != step.want {
+			t.Fatalf("%s: código %d, se esperaba %d", step.name, code, step.want)
+		}
+	}
+}
+
+// Si la cuenta debe restablecer la contraseña, sus tokens se rechazan aunque
+// su sesión siga abierta
+func TestMustResetPasswordTokens(t *testing.T) {
+	router := newTestServer(t, nil)
+	login := registerAndLogin(t, router, "maria", "maria")
+	if err := middleware.Users.SetMustResetPassword(login.User.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+	}{
+		{"perfil", http.MethodGet, "/api/auth/profile", nil},
+		{"sesiones", http.MethodGet, "/api/auth/sessions", nil},
+		{"claves de API", http.MethodPost, "/api/auth/api-keys", models.CreateAPIKeyRequest{Name: "ci"}},
+		{"cambio de contraseña", http.MethodPost, "/api/auth/password", models.ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: "Otra-Clave-Segura-7"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, login.Token, tt.body, nil); code != http.StatusForbidden {
+				t.Errorf("%s %s: código %d, se esperaba %d", tt.method, tt.path, code, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	router := newTestServer(t, nil)
+	first := registerAndLogin(t, router, "maria", "maria")
+	second := loginAs(t, router, "maria")
+
+	logout := func(token, refreshToken string) int {
+		return doJSON(t, router, http.MethodPost, "/api/auth/logout", token, models.LogoutRequest{RefreshToken: refreshToken}, nil)
+	}
+
+	// Los pasos dependen de los anteriores y se ejecutan en orden
+	steps := []struct {
+		name string
+		run  func() int
+		want int
+	}{
+		{"cerrar la primera sesión", func() int { return logout(first.Token, first.RefreshToken) }, http.StatusOK},
+		{"el token de acceso queda revocado", func() int {
+			return doJSON(t, router, http.MethodGet, "/api/auth/profile", first.Token, nil, nil)
+		}, http.StatusUnauthorized},
+		{"el token de renovación queda revocado", func() int {
+			return doJSON(t, router, http.MethodPost, "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: first.RefreshToken}, nil)
+		}, http.StatusUnauthorized},
+		{"la otra sesión sigue activa", func() int {
+			return doJSON(t, router, http.MethodGet, "/api/auth/profile", second.Token, nil, nil)
+		}, http.StatusOK},
+		{"cerrar otra vez la primera sesión desde la segunda", func() int { return logout(second.Token, first.RefreshToken) }, http.StatusOK},
+		{"la segunda sesión queda cerrada", func() int {
+			return doJSON(t, router, http.MethodGet, "/api/auth/profile", second.Token, nil, nil)
+		}, http.StatusUnauthorized},
+		{"cerrar sesión con un token revocado", func() int { return logout(second.Token, "") }, http.StatusUnauthorized},
+	}
+
+	for _, step := range steps {
+		if code := step.run(); code != step.want {
+			t.Fatalf("%s: código %d, se esperaba %d", step.name, code, step.want)
+		}
+	}
+}
+
+func TestRefreshReuseDetection(t *testing.T) {
+	router := newTestServer(t, nil)
+	first := registerAndLogin(t, router, "maria", "maria")
+
+	// Una segunda sesión del mismo usuario, que no debe verse afectada
+	other := loginAs(t, router, "maria")
+
+	var rotated models.TokenResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: first.RefreshToken}, &rotated); code != http.StatusOK {
+		t.Fatalf("renovación: código %d, se esperaba %d", code, http.StatusOK)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{"reutilizar el token ya rotado", http.MethodPost, "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: first.RefreshToken}, http.StatusUnauthorized},
+		{"el token nuevo de la familia queda revocado", http.MethodPost, "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: rotated.RefreshToken}, http.StatusUnauthorized},
+		{"el token de acceso de la sesión queda revocado", http.MethodGet, "/api/auth/profile", rotated.Token, nil, http.StatusUnauthorized},
+		{"la otra sesión sigue activa", http.MethodGet, "/api/auth/profile", other.Token, nil, http.StatusOK},
+		{"la otra sesión puede renovar", http.MethodPost, "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: other.RefreshToken}, http.StatusOK},
+		{"token desconocido", http.MethodPost, "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: "desconocido"}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tt.token, tt.body, nil); code != tt.want {
+				t.Errorf("%s %s: código %d, se esperaba %d", tt.method, tt.path, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleManagementEscalation(t *testing.T) {
+	router := newTestServer(t, nil)
+
+	admin := registerAndLogin(t, router, "admin1", "admin1")
+	if err := middleware.Users.UpdateRole(admin.User.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := loginAs(t, router, "admin1").Token
+
+	// Un rol que administra roles, pero no usuarios
+	var manager models.Role
+	body := models.CreateRoleRequest{Name: "gestor", Permissions: []string{models.PermRoles, models.PermUsersRead}}
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/admin/roles", adminToken, body, &manager); code != http.StatusCreated {
+		t.Fatalf("crear rol gestor: código %d", code)
+	}
+	var reader models.Role
+	body = models.CreateRoleRequest{Name: "lector", Permissions: []string{models.PermUsersRead}}
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/admin/roles", adminToken, body, &reader); code != http.StatusCreated {
+		t.Fatalf("crear rol lector: código %d", code)
+	}
+	var auditor models.Role
+	body = models.CreateRoleRequest{Name: "auditor", Permissions: []string{models.PermUsersRead, models.PermAuditRead}}
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/admin/roles", adminToken, body, &auditor); code != http.StatusCreated {
+		t.Fatalf("crear rol auditor: código %d", code)
+	}
+
+	luis := registerAndLogin(t, router, "luis", "luis")
+	if err := middleware.Users.UpdateRole(luis.User.ID, manager.Name); err != nil {
+		t.Fatal(err)
+	}
+	managerToken := loginAs(t, router, "luis").Token
+
+	rolePath := func(role models.Role) string { return "/api/auth/admin/roles/" + strconv.Itoa(role.ID) }
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{"crear un rol con un permiso propio", http.MethodPost, "/api/auth/admin/roles", managerToken, models.CreateRoleRequest{Name: "consulta", Permissions: []string{models.PermUsersRead}}, http.StatusCreated},
+		{"crear un rol con un permiso ajeno", http.MethodPost, "/api/auth/admin/roles", managerToken, models.CreateRoleRequest{Name: "editor", Permissions: []string{models.PermUsersWrite}}, http.StatusForbidden},
+		{"ampliar otro rol con un permiso ajeno", http.MethodPut, rolePath(reader), managerToken, models.UpdateRolePermissionsRequest{Permissions: []string{models.PermUsersRead, models.PermUsersWrite}}, http.StatusForbidden},
+		{"modificar otro rol con permisos propios", http.MethodPut, rolePath(reader), managerToken, models.UpdateRolePermissionsRequest{Permissions: []string{models.PermUsersRead, models.PermRoles}}, http.StatusOK},
+		{"modificar el propio rol", http.MethodPut, rolePath(manager), managerToken, models.UpdateRolePermissionsRequest{Permissions: []string{models.PermRoles}}, http.StatusForbidden},
+		{"quitar a otro rol un permiso ajeno", http.MethodPut, rolePath(auditor), managerToken, models.UpdateRolePermissionsRequest{Permissions: []string{models.PermUsersRead}}, http.StatusForbidden},
+		{"nombre de 20 caracteres", http.MethodPost, "/api/auth/admin/roles", adminToken, models.CreateRoleRequest{Name: strings.Repeat("r", 20)}, http.StatusCreated},
+		{"nombre de 21 caracteres", http.MethodPost, "/api/auth/admin/roles", adminToken, models.CreateRoleRequest{Name: strings.Repeat("r", 21)}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, tt.token, tt.body, nil); code != tt.want {
+				t.Errorf("%s %s: código %d, se esperaba %d", tt.method, tt.path, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserManagementEscalation(t *testing.T) {
+	router := newTestServer(t, nil)
+
+	admin := registerAndLogin(t, router, "admin1", "admin1")
+	if err := middleware.Users.UpdateRole(admin.User.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := loginAs(t, router, "admin1").Token
+
+	// Un rol que administra usuarios, pero no tiene todos los permisos de admin
+	body := models.CreateRoleRequest{Name: "moderador", Permissions: []string{models.PermUsersRead, models.PermUsersWrite}}
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/admin/roles", adminToken, body, nil); code != http.StatusCreated {
+		t.Fatalf("crear rol moderador: código %d", code)
+	}
+	sara := registerAndLogin(t, router, "sara", "sara")
+	if err := middleware.Users.UpdateRole(sara.User.ID, "moderador"); err != nil {
+		t.Fatal(err)
+	}
+	moderatorToken := loginAs(t, router, "sara").Token
+	pedro := registerAndLogin(t, router, "pedro", "pedro")
+
+	userPath := func(id int, action string) string {
+		return "/api/auth/admin/users/" + strconv.Itoa(id) + action
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{"cambiar el rol de un administrador", http.MethodPut, userPath(admin.User.ID, "/role"), models.UpdateRoleRequest{Role: models.RoleUser}, http.StatusForbidden},
+		{"deshabilitar a un administrador", http.MethodPost, userPath(admin.User.ID, "/disable"), nil, http.StatusForbidden},
+		{"obligar a un administrador a restablecer la contraseña", http.MethodPost, userPath(admin.User.ID, "/force-password-reset"), nil, http.StatusForbidden},
+		{"eliminar a un administrador", http.MethodDelete, userPath(admin.User.ID, ""), nil, http.StatusForbidden},
+		{"obligarse a restablecer la propia contraseña", http.MethodPost, userPath(sara.User.ID, "/force-password-reset"), nil, http.StatusBadRequest},
+		{"deshabilitar a un usuario", http.MethodPost, userPath(pedro.User.ID, "/disable"), nil, http.StatusOK},
+		{"obligar a un usuario a restablecer la contraseña", http.MethodPost, userPath(pedro.User.ID, "/force-password-reset"), nil, http.StatusOK},
+		{"eliminar a un usuario", http.MethodDelete, userPath(pedro.User.ID, ""), nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, moderatorToken, tt.body, nil); code != tt.want {
+				t.Errorf("%s %s: código %d, se esperaba %d", tt.method, tt.path, code, tt.want)
+			}
+		})
+	}
+
+	// El administrador sigue intacto
+	stored, err := middleware.Users.FindByID(admin.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Role != models.RoleAdmin || stored.Disabled || stored.MustResetPassword {
+		t.Errorf("administrador = %+v, se esperaba sin cambios", stored)
+	}
+}
+
+// readBootstrapCode lee el código de invitación inicial del archivo
+func readBootstrapCode(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("leer %s: %v", path, err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestBootstrapInvitation(t *testing.T) {
+	router := newTestServer(t, nil)
+	cfg := config.Config{BootstrapInvitationFile: "bootstrap_invitation.txt", InvitationTTL: time.Hour}
+
+	if err := controllers.EnsureBootstrapInvitation(cfg, middleware.Users); err != nil {
+		t.Fatal(err)
+	}
+	code := readBootstrapCode(t, cfg.BootstrapInvitationFile)
+	if info, err := os.Stat(cfg.BootstrapInvitationFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("permisos del archivo = %v, %v; se esperaba 0600", info.Mode().Perm(), err)
+	}
+
+	// Un reinicio o una réplica con la invitación vigente la reutilizan
+	if err := controllers.EnsureBootstrapInvitation(cfg, middleware.Users); err != nil {
+		t.Fatal(err)
+	}
+	if again := readBootstrapCode(t, cfg.BootstrapInvitationFile); again != code {
+		t.Errorf("el código cambió con una invitación vigente")
+	}
+	invitations, err := db.ListInvitations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invitations) != 1 {
+		t.Fatalf("%d invitaciones, se esperaba 1", len(invitations))
+	}
+
+	// Una invitación expirada se reemplaza por otra
+	if _, err := db.Database.Exec("UPDATE invitations SET expires_at = ?", time.Now().Add(-time.Minute).UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := controllers.EnsureBootstrapInvitation(cfg, middleware.Users); err != nil {
+		t.Fatal(err)
+	}
+	renewed := readBootstrapCode(t, cfg.BootstrapInvitationFile)
+	if renewed == code {
+		t.Error("el código no cambió al expirar la invitación")
+	}
+	if invitations, err = db.ListInvitations(); err != nil {
+		t.Fatal(err)
+	}
+	if len(invitations) != 1 || invitations[0].ExpiresAt.Before(time.Now()) {
+		t.Fatalf("invitaciones = %+v, se esperaba solo la nueva", invitations)
+	}
+
+	// El código anterior ya no sirve; el nuevo crea un administrador
+	register := models.RegisterRequest{Username: "admin1", Email: "admin1@example.com", Password: testPassword, InviteCode: code}
+	if status := doJSON(t, router, http.MethodPost, "/api/auth/register", "", register, nil); status != http.StatusBadRequest {
+		t.Errorf("registro con el código expirado: código %d, se esperaba %d", status, http.StatusBadRequest)
+	}
+	register.InviteCode = renewed
+	if status := doJSON(t, router, http.MethodPost, "/api/auth/register", "", register, nil); status != http.StatusCreated {
+		t.Fatalf("registro con el código nuevo: código %d, se esperaba %d", status, http.StatusCreated)
+	}
+	if admin := loginAs(t, router, "admin1"); admin.User.Role != models.RoleAdmin {
+		t.Errorf("rol = %q, se esperaba %q", admin.User.Role, models.RoleAdmin)
+	}
+
+	// Con un administrador registrado el archivo se elimina
+	if err := controllers.EnsureBootstrapInvitation(cfg, middleware.Users); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cfg.BootstrapInvitationFile); !os.IsNotExist(err) {
+		t.Errorf("el archivo sigue existiendo: %v", err)
+	}
+}
+
+func TestInvitations(t *testing.T) {
+	router := newTestServer(t, nil)
+
+	admin := registerAndLogin(t, router, "admin1", "admin1")
+	if err := middleware.Users.UpdateRole(admin.User.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := loginAs(t, router, "admin1").Token
+	userToken := registerAndLogin(t, router, "pedro", "pedro").Token
+
+	create := func(body models.CreateInvitationRequest) models.CreateInvitationResponse {
+		t.Helper()
+		var created models.CreateInvitationResponse
+		if code := doJSON(t, router, http.MethodPost, "/api/auth/admin/invitations", adminToken, body, &created); code != http.StatusCreated {
+			t.Fatalf("crear invitación: código %d, se esperaba %d", code, http.StatusCreated)
+		}
+		return created
+	}
+	invited := create(models.CreateInvitationRequest{Role: models.RoleAdmin, Email: "ana@example.com"})
+	revoked := create(models.CreateInvitationRequest{Role: models.RoleUser})
+	invitationPath := func(inv models.CreateInvitationResponse) string {
+		return "/api/auth/admin/invitations/" + strconv.Itoa(inv.Invitation.ID)
+	}
+	registerWith := func(username, code string) int {
+		body := models.RegisterRequest{Username: username, Email: username + "@example.com", Password: testPassword, InviteCode: code}
+		return doJSON(t, router, http.MethodPost, "/api/auth/register", "", body, nil)
+	}
+
+	// Los pasos dependen de los anteriores y se ejecutan en orden
+	steps := []struct {
+		name string
+		run  func() int
+		want int
+	}{
+		{"crear una invitación sin permiso", func() int {
+			return doJSON(t, router, http.MethodPost, "/api/auth/admin/invitations", userToken, models.CreateInvitationRequest{Role: models.RoleUser}, nil)
+		}, http.StatusForbidden},
+		{"crear una invitación para un rol inexistente", func() int {
+			return doJSON(t, router, http.MethodPost, "/api/auth/admin/invitations", adminToken, models.CreateInvitationRequest{Role: "inexistente"}, nil)
+		}, http.StatusBadRequest},
+		{"registrarse con un código inventado", func() int { return registerWith("luis", "codigo-inventado") }, http.StatusBadRequest},
+		{"registrarse con otro correo", func() int { return registerWith("luis", invited.Code) }, http.StatusBadRequest},
+		{"registrarse con el correo de la invitación", func() int { return registerWith("ana", invited.Code) }, http.StatusCreated},
+		{"reutilizar la invitación", func() int { return registerWith("ana2", invited.Code) }, http.StatusBadRequest},
+		{"revocar una invitación usada", func() int {
+			return doJSON(t, router, http.MethodDelete, invitationPath(invited), adminToken, nil, nil)
+		}, http.StatusConflict},
+		{"revocar una invitación pendiente", func() int {
+			return doJSON(t, router, http.MethodDelete, invitationPath(revoked), adminToken, nil, nil)
+		}, http.StatusOK},
+		{"registrarse con la invitación revocada", func() int { return registerWith("luis", revoked.Code) }, http.StatusBadRequest},
+		{"revocar de nuevo", func() int {
+			return doJSON(t, router, http.MethodDelete, invitationPath(revoked), adminToken, nil, nil)
+		}, http.StatusNotFound},
+	}
+	for _, step := range steps {
+		if code := step.run(); code != step.want {
+			t.Fatalf("%s: código %d, se esperaba %d", step.name, code, step.want)
+		}
+	}
+
+	if ana := loginAs(t, router, "ana"); ana.User.Role != models.RoleAdmin {
+		t.Errorf("rol = %q, se esperaba %q", ana.User.Role, models.RoleAdmin)
+	}
+
+	// Solo queda la invitación usada, con su estado
+	var invitations []models.InvitationResponse
+	if code := doJSON(t, router, http.MethodGet, "/api/auth/admin/invitations", adminToken, nil, &invitations); code != http.StatusOK {
+		t.Fatalf("listar invitaciones: código %d", code)
+	}
+	if len(invitations) != 1 || invitations[0].ID != invited.Invitation.ID || invitations[0].Status != "used" {
+		t.Errorf("invitaciones = %+v, se esperaba solo la usada", invitations)
+	}
+}
+
+// mailLinkPattern encuentra los enlaces con token de los correos enviados
+var mailLinkPattern = regexp.MustCompile(`(/[a-z/-]+)\?token=([^\s]+)`)
+
+// mailToken devuelve el token del enlace con la ruta indicada enviado a to.
+// Falla si no hay exactamente un correo así en la bandeja de salida.
+func mailToken(t *testing.T, to, path string) string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join("outbox", "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tokens []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "To: "+to+"\r\n") {
+			continue
+		}
+		for _, match := range mailLinkPattern.FindAllStringSubmatch(string(data), -1) {
+			if match[1] == path {
+				token, err := url.QueryUnescape(match[2])
+				if err != nil {
+					t.Fatal(err)
+				}
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	if len(tokens) != 1 {
+		t.Fatalf("se esperaba un correo a %s con un enlace a %s, hay %d", to, path, len(tokens))
+	}
+	return tokens[0]
+}
+
+// clearOutbox elimina los correos enviados hasta el momento
+func clearOutbox(t *testing.T) {
+	t.Helper()
+	if err := os.RemoveAll("outbox"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("outbox", 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	router := newTestServer(t, nil)
+	maria := registerAndLogin(t, router, "maria", "maria")
+
+	clearOutbox(t)
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/password/forgot", "", models.ForgotPasswordRequest{Email: "maria@example.com"}, nil); code != http.StatusOK {
+		t.Fatalf("solicitar el enlace de restablecimiento: código %d", code)
+	}
+	token := mailToken(t, "maria@example.com", "/reset-password")
+
+	const newPassword = "Otra-Clave-Segura-7"
+	reset := func(password string) int {
+		return doJSON(t, router, http.MethodPost, "/api/auth/password/reset", "", models.ResetPasswordRequest{Token: token, Password: password}, nil)
+	}
+	login := func(password string) int {
+		return doJSON(t, router, http.MethodPost, "/api/auth/login", "", models.LoginRequest{Identifier: "maria", Password: password}, nil)
+	}
+
+	// Los pasos dependen de los anteriores y se ejecutan en orden
+	steps := []struct {
+		name string
+		run  func() int
+		want int
+	}{
+		{"contraseña rechazada por la política", func() int { return reset("corta") }, http.StatusBadRequest},
+		{"la contraseña no cambió", func() int { return login(testPassword) }, http.StatusOK},
+		{"el token sigue sirviendo tras el rechazo", func() int { return reset(newPassword) }, http.StatusOK},
+		{"reutilizar el token", func() int { return reset("Tercera-Clave-Segura-9") }, http.StatusBadRequest},
+		{"el token de acceso anterior se rechaza", func() int {
+			return doJSON(t, router, http.MethodGet, "/api/auth/profile", maria.Token, nil, nil)
+		}, http.StatusUnauthorized},
+		{"el token de renovación anterior se rechaza", func() int {
+			return doJSON(t, router, http.MethodPost, "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: maria.RefreshToken}, nil)
+		}, http.StatusUnauthorized},
+		{"la contraseña anterior ya no sirve", func() int { return login(testPassword) }, http.StatusUnauthorized},
+		{"inicio de sesión con la nueva contraseña", func() int { return login(newPassword) }, http.StatusOK},
+	}
+
+	for _, step := range steps {
+		if code := step.run(); code != step.want {
+			t.Fatalf("%s: código %d, se esperaba %d", step.name, code, step.want)
+		}
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	router := newTestServer(t, nil)
+
+	clearOutbox(t)
+	maria := registerAndLogin(t, router, "maria", "maria")
+	ana := registerAndLogin(t, router, "ana", "ana")
+	mariaToken := mailToken(t, "maria@example.com", "/api/auth/verify")
+	anaToken := mailToken(t, "ana@example.com", "/api/auth/verify")
+
+	// El correo de ana cambia después de enviarse el enlace
+	if err := middleware.Users.SetPendingEmail(ana.User.ID, "ana.nueva@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := middleware.Users.ConfirmEmailChange(ana.User.ID, "ana.nueva@example.com"); err != nil || !changed {
+		t.Fatalf("ConfirmEmailChange = %v, %v", changed, err)
+	}
+
+	verify := func(token string) int {
+		return doJSON(t, router, http.MethodGet, "/api/auth/verify?token="+url.QueryEscape(token), "", nil, nil)
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"verificar el correo", mariaToken, http.StatusOK},
+		{"reutilizar el enlace", mariaToken, http.StatusBadRequest},
+		{"enlace enviado a un correo que ya no es el del usuario", anaToken, http.StatusBadRequest},
+		{"token inventado", "token-inventado", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := verify(tt.token); code != tt.want {
+				t.Errorf("código %d, se esperaba %d", code, tt.want)
+			}
+		})
+	}
+
+	user, err := middleware.Users.FindByID(maria.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.EmailVerified {
+		t.Error("el correo de maria no quedó verificado")
+	}
+}
+
+func TestEmailChangeInvalidatesTokens(t *testing.T) {
+	router := newTestServer(t, nil)
+	login := registerAndLogin(t, router, "maria", "maria")
+
+	// Enlaces pendientes enviados al correo actual
+	doJSON(t, router, http.MethodPost, "/api/auth/password/forgot", "", models.ForgotPasswordRequest{Email: "maria@example.com"}, nil)
+	doJSON(t, router, http.MethodPost, "/api/auth/magic-link", "", models.MagicLinkRequest{Email: "maria@example.com"}, nil)
+	resetToken := mailToken(t, "maria@example.com", "/reset-password")
+	magicToken := mailToken(t, "maria@example.com", "/api/auth/magic-link/consume")
+
+	change := models.ChangeEmailRequest{NewEmail: "nueva@example.com", Password: testPassword}
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/email/change", login.Token, change, nil); code != http.StatusOK {
+		t.Fatalf("solicitar el cambio de correo: código %d", code)
+	}
+	confirmToken := mailToken(t, "nueva@example.com", "/api/auth/email/confirm")
+	if code := doJSON(t, router, http.MethodGet, "/api/auth/email/confirm?token="+url.QueryEscape(confirmToken), "", nil, nil); code != http.StatusOK {
+		t.Fatalf("confirmar el cambio de correo: código %d", code)
+	}
+
+	// Otro enlace, enviado ya al correo nuevo, que deshacer el cambio debe anular
+	doJSON(t, router, http.MethodPost, "/api/auth/magic-link", "", models.MagicLinkRequest{Email: "nueva@example.com"}, nil)
+	newMagicToken := mailToken(t, "nueva@example.com", "/api/auth/magic-link/consume")
+	undoToken := mailToken(t, "maria@example.com", "/api/auth/email/undo")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{"reutilizar la confirmación", http.MethodGet, "/api/auth/email/confirm?token=" + url.QueryEscape(confirmToken), nil, http.StatusBadRequest},
+		{"restablecer con el enlace enviado al correo anterior", http.MethodPost, "/api/auth/password/reset", models.ResetPasswordRequest{Token: resetToken, Password: "Otra-Clave-Segura-7"}, http.StatusBadRequest},
+		{"enlace de inicio de sesión enviado al correo anterior", http.MethodGet, "/api/auth/magic-link/consume?token=" + url.QueryEscape(magicToken), nil, http.StatusBadRequest},
+		{"iniciar sesión con el correo nuevo", http.MethodPost, "/api/auth/login", models.LoginRequest{Identifier: "nueva@example.com", Password: testPassword}, http.StatusOK},
+		{"deshacer el cambio", http.MethodGet, "/api/auth/email/undo?token=" + url.QueryEscape(undoToken), nil, http.StatusOK},
+		{"reutilizar el enlace para deshacer", http.MethodGet, "/api/auth/email/undo?token=" + url.QueryEscape(undoToken), nil, http.StatusBadRequest},
+		{"enlace de inicio de sesión enviado al correo deshecho", http.MethodGet, "/api/auth/magic-link/consume?token=" + url.QueryEscape(newMagicToken), nil, http.StatusBadRequest},
+		{"iniciar sesión tras deshacer exige restablecer la contraseña", http.MethodPost, "/api/auth/login", models.LoginRequest{Identifier: "maria@example.com", Password: testPassword}, http.StatusForbidden},
+	}
+
+	// Los casos dependen del orden: cada uno parte del estado que deja el anterior
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := doJSON(t, router, tt.method, tt.path, "", tt.body, nil); code != tt.want {
+				t.Errorf("%s %s: código %d, se esperaba %d", tt.method, tt.path, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMagicLink(t *testing.T) {
+	router := newTestServer(t, nil)
+	registerAndLogin(t, router, "maria", "maria")
+
+	request := func(email string) int {
+		return doJSON(t, router, http.MethodPost, "/api/auth/magic-link", "", models.MagicLinkRequest{Email: email}, nil)
+	}
+	consume := func(token string) (int, models.TokenResponse) {
+		var response models.TokenResponse
+		code := doJSON(t, router, http.MethodGet, "/api/auth/magic-link/consume?token="+url.QueryEscape(token), "", nil, &response)
+		return code, response
+	}
+
+	// Un correo no registrado recibe la misma respuesta y ningún enlace
+	if code := request("nadie@example.com"); code != http.StatusOK {
+		t.Errorf("correo no registrado: código %d, se esperaba %d", code, http.StatusOK)
+	}
+	if files, _ := filepath.Glob(filepath.Join("outbox", "*.eml")); len(files) != 1 {
+		t.Errorf("hay %d correos, se esperaba solo el de verificación del registro", len(files))
+	}
+
+	// Pedir un enlace nuevo anula el anterior
+	request("maria@example.com")
+	first := mailToken(t, "maria@example.com", "/api/auth/magic-link/consume")
+	clearOutbox(t)
+	request("MARIA@example.com")
+	second := mailToken(t, "maria@example.com", "/api/auth/magic-link/consume")
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"enlace anulado por uno nuevo", first, http.StatusBadRequest},
+		{"enlace vigente", second, http.StatusOK},
+		{"enlace reutilizado", second, http.StatusBadRequest},
+		{"token desconocido", "desconocido", http.StatusBadRequest},
+		{"sin token", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := consume(tt.token)
+			if code != tt.want {
+				t.Fatalf("código %d, se esperaba %d", code, tt.want)
+			}
+			if code == http.StatusOK && (response.Token == "" || !response.User.EmailVerified) {
+				t.Errorf("respuesta = %+v, se esperaban tokens y el correo verificado", response)
+			}
+		})
+	}
+}
+
+// doForm envía una solicitud con cuerpo application/x-www-form-urlencoded y
+// credenciales HTTP Basic si clientID no está vacío
+func doForm(t *testing.T, router *gin.Engine, path, clientID, secret string, form url.Values, out any) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if out != nil && rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("POST %s: respuesta inválida %q: %v", path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestClientCredentials(t *testing.T) {
+	router := newTestServer(t, nil)
+
+	admin := registerAndLogin(t, router, "admin1", "admin1")
+	if err := middleware.Users.UpdateRole(admin.User.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := loginAs(t, router, "admin1").Token
+
+	createClient := func(name string) models.CreateOAuthClientResponse {
+		var created models.CreateOAuthClientResponse
+		body := models.CreateOAuthClientRequest{Name: name, Scopes: []string{"reservas:read", "reservas:write"}}
+		if code := doJSON(t, router, http.MethodPost, "/api/auth/admin/oauth/clients", adminToken, body, &created); code != http.StatusCreated {
+			t.Fatalf("crear cliente %s: código %d", name, code)
+		}
+		return created
+	}
+	client := createClient("reservas")
+	deleted := createClient("eliminado")
+	if code := doJSON(t, router, http.MethodDelete, "/api/auth/admin/oauth/clients/"+strconv.Itoa(deleted.Client.ID), adminToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("eliminar cliente: código %d", code)
+	}
+
+	grant := url.Values{"grant_type": {"client_credentials"}}
+	withScope := func(scope string) url.Values {
+		return url.Values{"grant_type": {"client_credentials"}, "scope": {scope}}
+	}
+	inBody := url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ClientID}, "client_secret": {client.ClientSecret}}
+
+	tests := []struct {
+		name      string
+		clientID  string
+		secret    string
+		form      url.Values
+		want      int
+		wantError string
+		wantScope string
+	}{
+		{"todos los scopes del cliente", client.ClientID, client.ClientSecret, grant, http.StatusOK, "", "reservas:read reservas:write"},
+		{"scope permitido", client.ClientID, client.ClientSecret, withScope("reservas:read"), http.StatusOK, "", "reservas:read"},
+		{"credenciales en el cuerpo", "", "", inBody, http.StatusOK, "", "reservas:read reservas:write"},
+		{"scope no permitido", client.ClientID, client.ClientSecret, withScope("reservas:read admin"), http.StatusBadRequest, "invalid_scope", ""},
+		{"secreto incorrecto", client.ClientID, "incorrecto", grant, http.StatusUnauthorized, "invalid_client", ""},
+		{"cliente desconocido", "desconocido", client.ClientSecret, grant, http.StatusUnauthorized, "invalid_client", ""},
+		{"cliente eliminado", deleted.ClientID, deleted.ClientSecret, grant, http.StatusUnauthorized, "invalid_client", ""},
+		{"sin credenciales", "", "", grant, http.StatusUnauthorized, "invalid_client", ""},
+		{"tipo de concesión no soportado", client.ClientID, client.ClientSecret, url.Values{"grant_type": {"password"}}, http.StatusBadRequest, "unsupported_grant_type", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response struct {
+				models.OAuthTokenResponse
+				models.OAuthError
+			}
+			code := doForm(t, router, "/oauth/token", tt.clientID, tt.secret, tt.form, &response)
+			if code != tt.want {
+				t.Fatalf("código %d, se esperaba %d", code, tt.want)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("error = %q, se esperaba %q", response.Error, tt.wantError)
+			}
+			if code != http.StatusOK {
+				return
+			}
+			if response.AccessToken == "" || response.Scope != tt.wantScope {
+				t.Errorf("respuesta = %+v, se esperaba el scope %q", response.OAuthTokenResponse, tt.wantScope)
+			}
+
+			// Un token de servicio no actúa sobre cuentas de usuario
+			if code := doJSON(t, router, http.MethodGet, "/api/auth/profile", response.AccessToken, nil, nil); code != http.StatusForbidden {
+				t.Errorf("perfil con token de servicio: código %d, se esperaba %d", code, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	router := newTestServer(t, nil)
+
+	admin := registerAndLogin(t, router, "admin1", "admin1")
+	if err := middleware.Users.UpdateRole(admin.User.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := loginAs(t, router, "admin1").Token
+	userToken := registerAndLogin(t, router, "carla", "carla").Token
+
+	createKey := func(token string, req models.CreateAPIKeyRequest) models.CreateAPIKeyResponse {
+		var created models.CreateAPIKeyResponse
+		if code := doJSON(t, router, http.MethodPost, "/api/auth/api-keys", token, req, &created); code != http.StatusCreated {
+			t.Fatalf("crear clave %s: código %d", req.Name, code)
+		}
+		return created
+	}
+	adminKey := createKey(adminToken, models.CreateAPIKeyRequest{Name: "admin", Role: models.RoleAdmin})
+	userKey := createKey(adminToken, models.CreateAPIKeyRequest{Name: "usuario"})
+	revokedKey := createKey(adminToken, models.CreateAPIKeyRequest{Name: "revocada", Role: models.RoleAdmin})
+	expiredKey := createKey(adminToken, models.CreateAPIKeyRequest{Name: "expirada", Role: models.RoleAdmin, ExpiresInDays: 1})
+
+	if code := doJSON(t, router, http.MethodDelete, "/api/auth/api-keys/"+strconv.Itoa(revokedKey.APIKey.ID), adminToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("revocar clave: código %d", code)
+	}
+	if _, err := db.Database.Exec("UPDATE api_keys SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Hour), expiredKey.APIKey.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Un usuario no puede crear una clave con un rol superior al suyo
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/api-keys", userToken, models.CreateAPIKeyRequest{Name: "escalada", Role: models.RoleAdmin}, nil); code != http.StatusForbidden {
+		t.Errorf("clave de administrador para un usuario: código %d, se esperaba %d", code, http.StatusForbidden)
+	}
+
+	request := func(key, method, path string, body any) int {
+		return doJSONWithAuthorization(t, router, method, path, "ApiKey "+key, body, nil)
+	}
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{"clave de administrador en una ruta de administración", adminKey.Key, http.MethodGet, "/api/auth/admin/users", nil, http.StatusOK},
+		{"clave de usuario en una ruta de administración", userKey.Key, http.MethodGet, "/api/auth/admin/users", nil, http.StatusForbidden},
+		{"clave de usuario en el perfil", userKey.Key, http.MethodGet, "/api/auth/profile", nil, http.StatusOK},
+		{"clave revocada", revokedKey.Key, http.MethodGet, "/api/auth/profile", nil, http.StatusUnauthorized},
+		{"clave expirada", expiredKey.Key, http.MethodGet, "/api/auth/profile", nil, http.StatusUnauthorized},
+		{"clave desconocida", "ak_desconocida", http.MethodGet, "/api/auth/profile", nil, http.StatusUnauthorized},
+		{"crear una clave con otra clave", adminKey.Key, http.MethodPost, "/api/auth/api-keys", models.CreateAPIKeyRequest{Name: "derivada"}, http.StatusForbidden},
+		{"iniciar la activación de TOTP", userKey.Key, http.MethodPost, "/api/auth/mfa/totp/enroll", models.TOTPEnrollRequest{Password: testPassword}, http.StatusForbidden},
+		{"confirmar la activación de TOTP", userKey.Key, http.MethodPost, "/api/auth/mfa/totp/confirm", models.TOTPCodeRequest{Code: "123456"}, http.StatusForbidden},
+		{"desactivar TOTP", userKey.Key, http.MethodDelete, "/api/auth/mfa/totp", models.TOTPCodeRequest{Code: "123456"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := request(tt.key, tt.method, tt.path, tt.body); code != tt.want {
+				t.Errorf("código %d, se esperaba %d", code, tt.want)
+			}
+		})
+	}
+
+	// Si el rol del usuario baja, la clave queda limitada al nuevo rol
+	if err := middleware.Users.UpdateRole(admin.User.ID, models.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	if code := request(adminKey.Key, http.MethodGet, "/api/auth/admin/users", nil); code != http.StatusForbidden {
+		t.Errorf("clave de administrador tras bajar el rol: código %d, se esperaba %d", code, http.StatusForbidden)
+	}
+	if code := request(adminKey.Key, http.MethodGet, "/api/auth/profile", nil); code != http.StatusOK {
+		t.Errorf("perfil con la clave tras bajar el rol: código %d, se esperaba %d", code, http.StatusOK)
+	}
+
+	var keys []models.APIKeyResponse
+	if code := doJSON(t, router, http.MethodGet, "/api/auth/api-keys", loginAs(t, router, "admin1").Token, nil, &keys); code != http.StatusOK {
+		t.Fatalf("listar claves: código %d", code)
+	}
+	status := map[string]string{}
+	for _, key := range keys {
+		status[key.Name] = key.Status
+	}
+	want := map[string]string{"admin": "active", "usuario": "active", "revocada": "revoked", "expirada": "expired"}
+	if !maps.Equal(status, want) {
+		t.Errorf("estados = %v, se esperaba %v", status, want)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	router := newTestServer(t, nil)
+	current := registerAndLogin(t, router, "maria", "maria")
+	other := loginAs(t, router, "maria")
+
+	const newPassword = "Otra-Contrasena-Segura-7"
+	change := func(currentPassword, password string) int {
+		body := models.ChangePasswordRequest{CurrentPassword: currentPassword, NewPassword: password}
+		return doJSON(t, router, http.MethodPost, "/api/auth/password", current.Token, body, nil)
+	}
+	login := func(password string) int {
+		return doJSON(t, router, http.MethodPost, "/api/auth/login", "", models.LoginRequest{Identifier: "maria", Password: password}, nil)
+	}
+
+	// Los pasos dependen de los anteriores y se ejecutan en orden
+	steps := []struct {
+		name string
+		run  func() int
+		want int
+	}{
+		{"contraseña actual incorrecta", func() int { return change("incorrecta", newPassword) }, http.StatusForbidden},
+		{"nueva contraseña débil", func() int { return change(testPassword, "corta") }, http.StatusBadRequest},
+		{"repetir la contraseña actual", func() int { return change(testPassword, testPassword) }, http.StatusBadRequest},
+		{"cambio correcto", func() int { return change(testPassword, newPassword) }, http.StatusOK},
+		{"la sesión actual sigue activa", func() int {
+			return doJSON(t, router, http.MethodGet, "/api/auth/profile", current.Token, nil, nil)
+		}, http.StatusOK},
+		{"las demás sesiones se cierran", func() int {
+			return doJSON(t, router, http.MethodPost, "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: other.RefreshToken}, nil)
+		}, http.StatusUnauthorized},
+		{"la contraseña anterior ya no sirve", func() int { return login(testPassword) }, http.StatusUnauthorized},
+		{"inicio de sesión con la nueva contraseña", func() int { return login(newPassword) }, http.StatusOK},
+	}
+
+	for _, step := range steps {
+		if code := step.run(); code != step.want {
+			t.Errorf("%s: código %d, se esperaba %d", step.name, code, step.want)
+		}
+	}
+}
+
+func TestAccountDeletion(t *testing.T) {
+	router := newTestServer(t, nil)
+	first := registerAndLogin(t, router, "maria", "maria")
+
+	var key models.CreateAPIKeyResponse
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/api-keys", first.Token, models.CreateAPIKeyRequest{Name: "script"}, &key); code != http.StatusCreated {
+		t.Fatalf("crear clave: código %d", code)
+	}
+
+	deleteAccount := func(token, password string) int {
+		var response models.AccountDeletionResponse
+		code := doJSON(t, router, http.MethodDelete, "/api/auth/account", token, models.DeleteAccountRequest{Password: password}, &response)
+		if code == http.StatusOK && !response.DeleteAfter.After(time.Now()) {
+			t.Errorf("delete_after = %v, se esperaba una fecha futura", response.DeleteAfter)
+		}
+		return code
+	}
+	var second models.TokenResponse
+
+	// Los pasos dependen de los anteriores y se ejecutan en orden
+	steps := []struct {
+		name string
+		run  func() int
+		want int
+	}{
+		{"contraseña incorrecta", func() int { return deleteAccount(first.Token, "incorrecta") }, http.StatusForbidden},
+		{"eliminación programada", func() int { return deleteAccount(first.Token, testPassword) }, http.StatusOK},
+		{"la sesión se cierra", func() int {
+			return doJSON(t, router, http.MethodGet, "/api/auth/profile", first.Token, nil, nil)
+		}, http.StatusUnauthorized},
+		{"la clave de API se rechaza", func() int {
+			return doJSONWithAuthorization(t, router, http.MethodGet, "/api/auth/profile", "ApiKey "+key.Key, nil, nil)
+		}, http.StatusForbidden},
+		{"el token de renovación se rechaza", func() int {
+			return doJSON(t, router, http.MethodPost, "/api/auth/refresh", "", models.RefreshRequest{RefreshToken: first.RefreshToken}, nil)
+		}, http.StatusUnauthorized},
+		{"iniciar sesión cancela la eliminación", func() int {
+			second = loginAs(t, router, "maria")
+			var profile models.User
+			code := doJSON(t, router, http.MethodGet, "/api/auth/profile", second.Token, nil, &profile)
+			if profile.DeleteAfter != nil {
+				t.Errorf("delete_after = %v tras iniciar sesión, se esperaba vacío", profile.DeleteAfter)
+			}
+			return code
+		}, http.StatusOK},
+		{"programar de nuevo", func() int { return deleteAccount(second.Token, testPassword) }, http.StatusOK},
+		{"la purga no elimina cuentas en el periodo de gracia", func() int {
+			purged, err := middleware.Users.PurgeDeleted(time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return purged
+		}, 0},
+		{"la purga elimina la cuenta vencida", func() int {
+			purged, err := middleware.Users.PurgeDeleted(time.Now().Add(31 * 24 * time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return purged
+		}, 1},
+		{"la cuenta eliminada no inicia sesión", func() int {
+			return doJSON(t, router, http.MethodPost, "/api/auth/login", "", models.LoginRequest{Identifier: "maria", Password: testPassword}, nil)
+		}, http.StatusUnauthorized},
+	}
+
+	for _, step := range steps {
+		if got := step.run(); got != step.want {
+			t.Errorf("%s: se obtuvo %d, se esperaba %d", step.name, got, step.want)
+		}
+	}
+}
+
+// download hace una solicitud GET con el token y devuelve la respuesta completa
+func download(t *testing.T, router *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAccountExport(t *testing.T) {
+	router := newTestServer(t, nil)
+
+	admin := registerAndLogin(t, router, "admin1", "admin1")
+	if err := middleware.Users.UpdateRole(admin.User.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := loginAs(t, router, "admin1").Token
+
+	// Además de la sesión del registro, una sesión cerrada, una activa y una clave de API
+	closed := registerAndLogin(t, router, "maria", "maria")
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/logout", closed.Token, models.LogoutRequest{RefreshToken: closed.RefreshToken}, nil); code != http.StatusOK {
+		t.Fatalf("cierre de sesión: código %d", code)
+	}
+	maria := loginAs(t, router, "maria")
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/api-keys", maria.Token, models.CreateAPIKeyRequest{Name: "script"}, nil); code != http.StatusCreated {
+		t.Fatalf("crear clave: código %d", code)
+	}
+	stored, err := middleware.Users.FindByID(maria.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userPath := "/api/auth/admin/users/" + strconv.Itoa(maria.User.ID) + "/export"
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"exportación propia", "/api/auth/account/export", maria.Token, http.StatusOK},
+		{"exportación propia en JSON", "/api/auth/account/export?format=json", maria.Token, http.StatusOK},
+		{"formato inválido", "/api/auth/account/export?format=csv", maria.Token, http.StatusBadRequest},
+		{"exportación de un administrador", userPath, adminToken, http.StatusOK},
+		{"exportación de otro usuario sin permiso", "/api/auth/admin/users/" + strconv.Itoa(admin.User.ID) + "/export", maria.Token, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := download(t, router, tt.path, tt.token)
+			if rec.Code != tt.want {
+				t.Fatalf("código %d, se esperaba %d", rec.Code, tt.want)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			if strings.Contains(rec.Body.String(), stored.Password) {
+				t.Error("la exportación incluye el hash de la contraseña")
+			}
+			if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment;") {
+				t.Errorf("Content-Disposition = %q, se esperaba un adjunto", got)
+			}
+
+			var export models.AccountExport
+			if err := json.Unmarshal(rec.Body.Bytes(), &export); err != nil {
+				t.Fatal(err)
+			}
+			if export.User.ID != maria.User.ID || len(export.Sessions) != 3 || len(export.APIKeys) != 1 || len(export.AuditEvents) == 0 {
+				t.Fatalf("exportación = usuario %d, %d sesiones, %d claves, %d eventos; se esperaban el usuario %d, 3 sesiones, 1 clave y eventos",
+					export.User.ID, len(export.Sessions), len(export.APIKeys), len(export.AuditEvents), maria.User.ID)
+			}
+			revoked := 0
+			for _, session := range export.Sessions {
+				if session.RevokedAt != nil {
+					revoked++
+				}
+			}
+			if revoked != 1 {
+				t.Errorf("%d sesiones revocadas, se esperaba 1", revoked)
+			}
+		})
+	}
+
+	// Los eventos de otros actores no incluyen sus datos
+	var export models.AccountExport
+	if err := json.Unmarshal(download(t, router, "/api/auth/account/export", maria.Token).Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	others := 0
+	for _, event := range export.AuditEvents {
+		if event.ActorID == maria.User.ID {
+			if event.IP == "" {
+				t.Errorf("evento propio sin IP: %+v", event)
+			}
+			continue
+		}
+		others++
+		if event.ActorName != "" || event.IP != "" || event.UserAgent != "" {
+			t.Errorf("evento de otro actor con sus datos: %+v", event)
+		}
+	}
+	if others == 0 {
+		t.Error("no hay eventos de otros actores en la exportación")
+	}
+
+	// El ZIP tiene un JSON por tipo de dato
+	rec := download(t, router, "/api/auth/account/export?format=zip", maria.Token)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("ZIP: código %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	want := []string{"user.json", "sessions.json", "api_keys.json", "audit_events.json"}
+	if !slices.Equal(names, want) {
+		t.Errorf("archivos del ZIP = %v, se esperaba %v", names, want)
+	}
+
+	// Cada exportación queda en la auditoría
+	var events models.AuditEventListResponse
+	path := "/api/auth/admin/audit-events?event_type=" + models.AuditAccountExported + "&target_id=" + strconv.Itoa(maria.User.ID)
+	if code := doJSON(t, router, http.MethodGet, path, adminToken, nil, &events); code != http.StatusOK {
+		t.Fatalf("auditoría: código %d", code)
+	}
+	if events.Total != 5 {
+		t.Errorf("%d exportaciones auditadas, se esperaban 5", events.Total)
+	}
+}
+
+// totpCode calcula el código TOTP del secreto en el instante indicado, como
+// lo haría una aplicación de autenticación
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func TestTOTPLogin(t *testing.T) {
+	router := newTestServer(t, nil)
+	maria := registerAndLogin(t, router, "maria", "maria")
+	now := time.Now()
+
+	// Activar TOTP exige la contraseña actual
+	enrollTests := []struct {
+		name string
+		body any
+		want int
+	}{
+		{"sin contraseña", map[string]string{}, http.StatusBadRequest},
+		{"contraseña incorrecta", models.TOTPEnrollRequest{Password: "incorrecta"}, http.StatusForbidden},
+		{"contraseña correcta", models.TOTPEnrollRequest{Password: testPassword}, http.StatusOK},
+	}
+	var enrollment models.TOTPEnrollResponse
+	for _, tt := range enrollTests {
+		if code := doJSON(t, router, http.MethodPost, "/api/auth/mfa/totp/enroll", maria.Token, tt.body, &enrollment); code != tt.want {
+			t.Fatalf("activación %s: código %d, se esperaba %d", tt.name, code, tt.want)
+		}
+	}
+
+	var recovery models.RecoveryCodesResponse
+	confirm := models.TOTPCodeRequest{Code: totpCode(t, enrollment.Secret, now)}
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/mfa/totp/confirm", maria.Token, confirm, &recovery); code != http.StatusOK {
+		t.Fatalf("confirmación: código %d", code)
+	}
+	if len(recovery.RecoveryCodes) != 10 {
+		t.Fatalf("%d códigos de recuperación, se esperaban 10", len(recovery.RecoveryCodes))
+	}
+
+	// startLogin hace el primer paso del inicio de sesión y devuelve el mfa_token
+	startLogin := func() string {
+		var challenge models.MFAChallengeResponse
+		body := models.LoginRequest{Identifier: "maria", Password: testPassword}
+		if code := doJSON(t, router, http.MethodPost, "/api/auth/login", "", body, &challenge); code != http.StatusOK || !challenge.MFARequired || challenge.MFAToken == "" {
+			t.Fatalf("inicio de sesión: código %d, respuesta %+v; se esperaba un mfa_token", code, challenge)
+		}
+		return challenge.MFAToken
+	}
+	loginMFA := func(mfaToken, code string) int {
+		return doJSON(t, router, http.MethodPost, "/api/auth/login/mfa", "", models.MFALoginRequest{MFAToken: mfaToken, Code: code}, nil)
+	}
+	next := totpCode(t, enrollment.Secret, now.Add(30*time.Second))
+	var failed string
+
+	// Los pasos dependen de los anteriores y se ejecutan en orden
+	steps := []struct {
+		name string
+		run  func() int
+		want int
+	}{
+		{"el código usado al confirmar no vale otra vez", func() int {
+			failed = startLogin()
+			return loginMFA(failed, confirm.Code)
+		}, http.StatusUnauthorized},
+		{"el mfa_token de un intento fallido queda consumido", func() int { return loginMFA(failed, next) }, http.StatusUnauthorized},
+		{"código del paso siguiente", func() int { return loginMFA(startLogin(), next) }, http.StatusOK},
+		{"el mismo código no vale dos veces", func() int { return loginMFA(startLogin(), next) }, http.StatusUnauthorized},
+		{"código de recuperación", func() int { return loginMFA(startLogin(), recovery.RecoveryCodes[0]) }, http.StatusOK},
+		{"código de recuperación en mayúsculas y con espacios", func() int {
+			return loginMFA(startLogin(), " "+strings.ToUpper(recovery.RecoveryCodes[1])+" ")
+		}, http.StatusOK},
+		{"código de recuperación ya usado", func() int { return loginMFA(startLogin(), recovery.RecoveryCodes[0]) }, http.StatusUnauthorized},
+		{"mfa_token desconocido", func() int { return loginMFA("desconocido", recovery.RecoveryCodes[2]) }, http.StatusUnauthorized},
+		{"desactivar TOTP con un código de recuperación", func() int {
+			return doJSON(t, router, http.MethodDelete, "/api/auth/mfa/totp", maria.Token, models.TOTPCodeRequest{Code: recovery.RecoveryCodes[2]}, nil)
+		}, http.StatusOK},
+	}
+
+	for _, step := range steps {
+		if code := step.run(); code != step.want {
+			t.Fatalf("%s: código %d, se esperaba %d", step.name, code, step.want)
+		}
+	}
+
+	// Sin TOTP, el inicio de sesión vuelve a devolver los tokens directamente
+	loginAs(t, router, "maria")
+}
+
+func TestIntrospection(t *testing.T) {
+	router := newTestServer(t, map[string]string{"INTROSPECTION_CLIENTS": "reservas:secreto-reservas"})
+
+	admin := registerAndLogin(t, router, "admin1", "admin1")
+	if err := middleware.Users.UpdateRole(admin.User.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken := loginAs(t, router, "admin1").Token
+
+	createClient := func(name string, scopes ...string) models.CreateOAuthClientResponse {
+		var created models.CreateOAuthClientResponse
+		body := models.CreateOAuthClientRequest{Name: name, Scopes: scopes}
+		if code := doJSON(t, router, http.MethodPost, "/api/auth/admin/oauth/clients", adminToken, body, &created); code != http.StatusCreated {
+			t.Fatalf("crear cliente %s: código %d", name, code)
+		}
+		return created
+	}
+	introspector := createClient("pasarela", "introspect")
+	other := createClient("informes", "informes:read")
+
+	maria := registerAndLogin(t, router, "maria", "maria")
+	revoked := loginAs(t, router, "maria")
+	if code := doJSON(t, router, http.MethodPost, "/api/auth/logout", revoked.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("cierre de sesión: código %d", code)
+	}
+	var service models.OAuthTokenResponse
+	grant := url.Values{"grant_type": {"client_credentials"}}
+	if code := doForm(t, router, "/oauth/token", other.ClientID, other.ClientSecret, grant, &service); code != http.StatusOK {
+		t.Fatalf("token de servicio: código %d", code)
+	}
+
+	// Un token con la firma correcta, pero ya expirado
+	expired, err := middleware.Keys.Sign(&middleware.Claims{
+		UserID: maria.User.ID,
+		Role:   models.RoleUser,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "maria",
+			ID:        "expirado",
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		clientID     string
+		secret       string
+		token        string
+		want         int
+		wantActive   bool
+		wantUserID   int
+		wantClientID string
+	}{
+		{"credencial de INTROSPECTION_CLIENTS", "reservas", "secreto-reservas", maria.Token, http.StatusOK, true, maria.User.ID, ""},
+		{"cliente OAuth con el scope introspect", introspector.ClientID, introspector.ClientSecret, maria.Token, http.StatusOK, true, maria.User.ID, ""},
+		{"token de servicio", "reservas", "secreto-reservas", service.AccessToken, http.StatusOK, true, 0, other.ClientID},
+		{"token revocado", "reservas", "secreto-reservas", revoked.Token, http.StatusOK, false, 0, ""},
+		{"token expirado", "reservas", "secreto-reservas", expired, http.StatusOK, false, 0, ""},
+		{"token inválido", "reservas", "secreto-reservas", "no-es-un-jwt", http.StatusOK, false, 0, ""},
+		{"sin token", "reservas", "secreto-reservas", "", http.StatusBadRequest, false, 0, ""},
+		{"secreto incorrecto", "reservas", "incorrecto", maria.Token, http.StatusUnauthorized, false, 0, ""},
+		{"cliente OAuth sin el scope introspect", other.ClientID, other.ClientSecret, maria.Token, http.StatusUnauthorized, false, 0, ""},
+		{"sin credenciales", "", "", maria.Token, http.StatusUnauthorized, false, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.token != "" {
+				form.Set("token", tt.token)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/introspect", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.clientID != "" {
+				req.SetBasicAuth(tt.clientID, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("código %d, se esperaba %d", rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusUnauthorized && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic ") {
+				t.Errorf("WWW-Authenticate = %q, se esperaba Basic", rec.Header().Get("WWW-Authenticate"))
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var response map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantActive {
+				// Un token inactivo no revela nada más
+				if len(response) != 1 || response["active"] != false {
+					t.Errorf("respuesta = %v, se esperaba solo active=false", response)
+				}
+				return
+			}
+			var introspection models.IntrospectionResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &introspection); err != nil {
+				t.Fatal(err)
+			}
+			if !introspection.Active || introspection.UserID != tt.wantUserID || introspection.ClientID != tt.wantClientID || introspection.Exp == 0 {
+				t.Errorf("respuesta = %+v, se esperaba activo con user_id %d y client_id %q", introspection, tt.wantUserID, tt.wantClientID)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package security
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// breachedPrefixLength es la cantidad de caracteres del SHA-1 usados como índice
+const breachedPrefixLength = 5
+
+// breachedRange es la porción del archivo con los hashes de un prefijo
+type breachedRange struct {
+	offset int64
+	length int64
+}
+
+// BreachedPasswords consulta un archivo local de contraseñas filtradas con
+// una línea por contraseña: su SHA-1 en hexadecimal, opcionalmente seguido de
+// ":<apariciones>" (el formato de las descargas de Have I Been Pwned). El
+// archivo debe estar ordenado por hash; al cargarlo solo se guarda en memoria
+// dónde empieza cada prefijo de 5 caracteres, y cada consulta lee únicamente
+// las líneas de su prefijo.
+type BreachedPasswords struct {
+	path  string
+	index map[string]breachedRange
+}
+
+// LoadBreachedPasswords indexa el archivo de contraseñas filtradas
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	breached := &BreachedPasswords{path: path, index: map[string]breachedRange{}}
+	reader := bufio.NewReader(file)
+	var offset int64
+	var prefix string
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+
+		hash := strings.TrimSpace(line)
+		if hash != "" {
+			if len(hash) < sha1.Size*2 {
+				return nil, fmt.Errorf("%s:%d: hash SHA-1 inválido", path, lineNumber)
+			}
+			current := strings.ToUpper(hash[:breachedPrefixLength])
+			if current < prefix {
+				return nil, fmt.Errorf("%s:%d: el archivo no está ordenado por hash", path, lineNumber)
+			}
+			if current != prefix {
+				prefix = current
+				breached.index[prefix] = breachedRange{offset: offset}
+			}
+			r := breached.index[prefix]
+			r.length = offset + int64(len(line)) - r.offset
+			breached.index[prefix] = r
+		}
+
+		offset += int64(len(line))
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return breached, nil
+}
+
+// Contains indica si la contraseña aparece en el archivo
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	r, ok := b.index[hash[:breachedPrefixLength]]
+	if !ok {
+		return false, nil
+	}
+
+	file, err := os.Open(b.path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(io.NewSectionReader(file, r.offset, r.length))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) >= len(hash) && strings.EqualFold(line[:len(hash)], hash) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,136 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algoritmos de hash de contraseñas soportados
+const (
+	PasswordAlgArgon2id = "argon2id"
+	PasswordAlgBcrypt   = "bcrypt"
+)
+
+// Longitudes de la sal y del hash argon2id, en bytes
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// ErrUnknownPasswordHash indica que el hash guardado no tiene un formato reconocido
+var ErrUnknownPasswordHash = errors.New("formato de hash de contraseña desconocido")
+
+// PasswordHasher cifra las contraseñas nuevas con el algoritmo y los
+// parámetros configurados, y verifica las guardadas con cualquiera de los
+// algoritmos soportados. Los hashes argon2id se guardan en formato PHC
+// ($argon2id$v=19$m=...,t=...,p=...$sal$hash) y los bcrypt en su formato
+// habitual ($2a$...).
+type PasswordHasher struct {
+	Algorithm string
+
+	// Parámetros de argon2id: memoria en KiB, iteraciones e hilos
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+
+	BcryptCost int
+}
+
+// Hash cifra una contraseña con el algoritmo configurado
+func (h PasswordHasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case PasswordAlgArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.Argon2Iterations, h.Argon2Memory, h.Argon2Parallelism, argon2KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, h.Argon2Memory, h.Argon2Iterations, h.Argon2Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	case PasswordAlgBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(hash), err
+	default:
+		return "", fmt.Errorf("algoritmo de hash de contraseñas no soportado: %q", h.Algorithm)
+	}
+}
+
+// Verify comprueba una contraseña contra un hash guardado. needsRehash indica
+// que la contraseña es correcta pero el hash usa otro algoritmo o parámetros
+// distintos de los configurados, y conviene volver a cifrarla.
+func (h PasswordHasher) Verify(password, encoded string) (match bool, needsRehash bool, err error) {
+	if strings.HasPrefix(encoded, "$argon2id$") {
+		params, salt, key, err := parseArgon2Hash(encoded)
+		if err != nil {
+			return false, false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, false, nil
+		}
+		upToDate := h.Algorithm == PasswordAlgArgon2id &&
+			params.memory == h.Argon2Memory &&
+			params.iterations == h.Argon2Iterations &&
+			params.parallelism == h.Argon2Parallelism &&
+			len(salt) == argon2SaltLength && len(key) == argon2KeyLength
+		return true, !upToDate, nil
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, false, ErrUnknownPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) != nil {
+		return false, false, nil
+	}
+	return true, h.Algorithm != PasswordAlgBcrypt || cost != h.BcryptCost, nil
+}
+
+// argon2Params son los parámetros leídos de un hash argon2id
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// parseArgon2Hash lee un hash argon2id en formato PHC
+func parseArgon2Hash(encoded string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", sal, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	if params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,106 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Parámetros bajos para que las pruebas sean rápidas
+var (
+	testArgon2 = PasswordHasher{Algorithm: PasswordAlgArgon2id, Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1}
+	testBcrypt = PasswordHasher{Algorithm: PasswordAlgBcrypt, BcryptCost: bcrypt.MinCost}
+)
+
+func TestPasswordHasherVerify(t *testing.T) {
+	const password = "Correcta-Caballo-42"
+
+	argon2Hash, err := testArgon2.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := testBcrypt.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strongerArgon2 := testArgon2
+	strongerArgon2.Argon2Iterations = 2
+	strongerBcrypt := testBcrypt
+	strongerBcrypt.BcryptCost = bcrypt.MinCost + 1
+
+	tests := []struct {
+		name       string
+		hasher     PasswordHasher
+		password   string
+		encoded    string
+		wantMatch  bool
+		wantRehash bool
+		wantErr    error
+	}{
+		{"argon2id correcta", testArgon2, password, argon2Hash, true, false, nil},
+		{"argon2id incorrecta", testArgon2, "otra", argon2Hash, false, false, nil},
+		{"argon2id con otras iteraciones", strongerArgon2, password, argon2Hash, true, true, nil},
+		{"argon2id con bcrypt configurado", testBcrypt, password, argon2Hash, true, true, nil},
+		{"bcrypt correcta", testBcrypt, password, bcryptHash, true, false, nil},
+		{"bcrypt incorrecta", testBcrypt, "otra", bcryptHash, false, false, nil},
+		{"bcrypt con otro coste", strongerBcrypt, password, bcryptHash, true, true, nil},
+		{"bcrypt con argon2id configurado", testArgon2, password, bcryptHash, true, true, nil},
+		{"hash vacío", testArgon2, password, "", false, false, ErrUnknownPasswordHash},
+		{"hash en texto plano", testArgon2, password, password, false, false, ErrUnknownPasswordHash},
+		{"argon2id de otra versión", testArgon2, password, strings.Replace(argon2Hash, "v=19", "v=16", 1), false, false, ErrUnknownPasswordHash},
+		{"argon2id sin parámetros", testArgon2, password, "$argon2id$v=19$$c2FsdA$a2V5", false, false, ErrUnknownPasswordHash},
+		{"argon2id con memoria cero", testArgon2, password, "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5", false, false, ErrUnknownPasswordHash},
+		{"argon2id sin hash", testArgon2, password, "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$", false, false, ErrUnknownPasswordHash},
+		{"argon2id con partes de más", testArgon2, password, argon2Hash + "$extra", false, false, ErrUnknownPasswordHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := tt.hasher.Verify(tt.password, tt.encoded)
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, se esperaba %v", err, tt.wantErr)
+			}
+			if match != tt.wantMatch || rehash != tt.wantRehash {
+				t.Errorf("Verify = (%v, %v), se esperaba (%v, %v)", match, rehash, tt.wantMatch, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherHash(t *testing.T) {
+	tests := []struct {
+		name       string
+		hasher     PasswordHasher
+		wantPrefix string
+		wantErr    bool
+	}{
+		{"argon2id", testArgon2, "$argon2id$v=19$m=1024,t=1,p=1$", false},
+		{"bcrypt", testBcrypt, "$2a$04$", false},
+		{"algoritmo desconocido", PasswordHasher{Algorithm: "md5"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := tt.hasher.Hash("Correcta-Caballo-42")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !strings.HasPrefix(first, tt.wantPrefix) {
+				t.Errorf("hash = %q, se esperaba el prefijo %q", first, tt.wantPrefix)
+			}
+
+			// Cada hash lleva una sal aleatoria
+			second, err := tt.hasher.Hash("Correcta-Caballo-42")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first == second {
+				t.Error("dos hashes de la misma contraseña no deben coincidir")
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reglas de la política de contraseñas
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleUppercase        = "uppercase"
+	RuleLowercase        = "lowercase"
+	RuleDigit            = "digit"
+	RuleSymbol           = "symbol"
+	RuleContainsUsername = "contains_username"
+	RuleContainsEmail    = "contains_email"
+	RuleHistory          = "history"
+	RuleBreached         = "breached"
+)
+
+// minUserInfoLength es la longitud mínima de un dato del usuario para
+// rechazar contraseñas que lo contengan (evita rechazar por nombres muy cortos)
+const minUserInfoLength = 3
+
+// PolicyViolation es una regla de la política que la contraseña no cumple
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy son las reglas que deben cumplir las contraseñas nuevas. Las
+// longitudes se cuentan en caracteres; un valor cero desactiva la regla.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+
+	// Rechazar contraseñas que contengan el nombre de usuario o el correo
+	DisallowUserInfo bool
+
+	// Archivo de contraseñas filtradas; nil desactiva la comprobación
+	Breached *BreachedPasswords
+}
+
+// Check devuelve las reglas que la contraseña no cumple. El historial de
+// contraseñas depende de la base de datos y se comprueba aparte.
+func (p PasswordPolicy) Check(password, username, email string) ([]PolicyViolation, error) {
+	violations := []PolicyViolation{}
+	add := func(rule, message string) {
+		violations = append(violations, PolicyViolation{Rule: rule, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		add(RuleMinLength, fmt.Sprintf("Debe tener al menos %d caracteres", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(RuleMaxLength, fmt.Sprintf("Debe tener como máximo %d caracteres", p.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUppercase && !upper {
+		add(RuleUppercase, "Debe contener al menos una letra mayúscula")
+	}
+	if p.RequireLowercase && !lower {
+		add(RuleLowercase, "Debe contener al menos una letra minúscula")
+	}
+	if p.RequireDigit && !digit {
+		add(RuleDigit, "Debe contener al menos un número")
+	}
+	if p.RequireSymbol && !symbol {
+		add(RuleSymbol, "Debe contener al menos un símbolo")
+	}
+
+	if p.DisallowUserInfo {
+		lowered := strings.ToLower(password)
+		if containsInfo(lowered, username) {
+			add(RuleContainsUsername, "No debe contener el nombre de usuario")
+		}
+		localPart, _, _ := strings.Cut(email, "@")
+		if containsInfo(lowered, email) || containsInfo(lowered, localPart) {
+			add(RuleContainsEmail, "No debe contener el correo electrónico")
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			add(RuleBreached, "Aparece en filtraciones de contraseñas conocidas")
+		}
+	}
+
+	return violations, nil
+}
+
+// containsInfo indica si la contraseña (en minúsculas) contiene el dato del usuario
+func containsInfo(lowered, info string) bool {
+	info = strings.ToLower(strings.TrimSpace(info))
+	return utf8.RuneCountInString(info) >= minUserInfoLength && strings.Contains(lowered, info)
+}
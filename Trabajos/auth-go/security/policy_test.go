@@ -0,0 +1,156 @@
+package security
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// rules devuelve las reglas incumplidas, para comparar sin los mensajes
+func rules(violations []PolicyViolation) []string {
+	names := []string{}
+	for _, v := range violations {
+		names = append(names, v.Rule)
+	}
+	return names
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	strict := PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        20,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowUserInfo: true,
+	}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		username string
+		email    string
+		want     []string
+	}{
+		{"cumple todas las reglas", strict, "Caballo-42", "maria", "maria@example.com", []string{}},
+		{"política vacía", PasswordPolicy{}, "", "maria", "maria@example.com", []string{}},
+		{"demasiado corta", strict, "Ca-4", "maria", "maria@example.com", []string{RuleMinLength}},
+		{"demasiado larga", strict, "Caballo-42" + strings.Repeat("x", 11), "maria", "maria@example.com", []string{RuleMaxLength}},
+		{"longitud en caracteres, no en bytes", PasswordPolicy{MaxLength: 8}, "ñandú-ñu", "", "", []string{}},
+		{"sin mayúsculas", strict, "caballo-42", "maria", "maria@example.com", []string{RuleUppercase}},
+		{"sin minúsculas", strict, "CABALLO-42", "maria", "maria@example.com", []string{RuleLowercase}},
+		{"sin números", strict, "Caballo-xx", "maria", "maria@example.com", []string{RuleDigit}},
+		{"sin símbolos", strict, "Caballo42", "maria", "maria@example.com", []string{RuleSymbol}},
+		{"los espacios no son símbolos", strict, "Caballo 42", "maria", "maria@example.com", []string{RuleSymbol}},
+		{"letras no latinas", strict, "Ωmega-ω42", "maria", "maria@example.com", []string{}},
+		{"contiene el nombre de usuario", strict, "xMaria-42", "maria", "otra@example.com", []string{RuleContainsUsername}},
+		{"contiene la parte local del correo", strict, "Pepito-42", "maria", "pepito@example.com", []string{RuleContainsEmail}},
+		{"contiene ambos", strict, "Maria-42!", "maria", "maria@example.com", []string{RuleContainsUsername, RuleContainsEmail}},
+		{"nombre demasiado corto para comprobarlo", strict, "Caballo-ab-42", "ab", "ab@example.com", []string{}},
+		{"datos del usuario permitidos", PasswordPolicy{}, "maria", "maria", "maria@example.com", []string{}},
+		{"varias reglas a la vez", strict, "abc", "maria", "maria@example.com", []string{RuleMinLength, RuleUppercase, RuleDigit, RuleSymbol}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := tt.policy.Check(tt.password, tt.username, tt.email)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if got := rules(violations); !slices.Equal(got, tt.want) {
+				t.Errorf("reglas incumplidas = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// sha1Hex devuelve el SHA-1 de la contraseña en hexadecimal en mayúsculas
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeBreachedFile escribe un archivo de contraseñas filtradas con las líneas indicadas
+func writeBreachedFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	hashes := []string{sha1Hex("password") + ":3861493", sha1Hex("123456") + ":37359195", sha1Hex("qwerty"), sha1Hex("Caballo-42")}
+	slices.Sort(hashes)
+	// Minúsculas y una línea final sin salto de línea
+	hashes[0] = strings.ToLower(hashes[0])
+	path := writeBreachedFile(t, append(hashes, "")...)
+
+	breached, err := LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords: %v", err)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"123456", true},
+		{"qwerty", true},
+		{"Caballo-42", true},
+		{"Password", false},
+		{"caballo-42", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got, err := breached.Contains(tt.password)
+			if err != nil {
+				t.Fatalf("Contains: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Contains(%q) = %v, se esperaba %v", tt.password, got, tt.want)
+			}
+		})
+	}
+
+	violations, err := PasswordPolicy{Breached: breached}.Check("qwerty", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rules(violations); !slices.Equal(got, []string{RuleBreached}) {
+		t.Errorf("reglas incumplidas = %v, se esperaba [%s]", got, RuleBreached)
+	}
+}
+
+func TestLoadBreachedPasswordsErrors(t *testing.T) {
+	a, b := sha1Hex("password"), sha1Hex("qwerty")
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"hash demasiado corto", []string{"ABCDEF"}},
+		{"sin ordenar", []string{max(a, b), min(a, b)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadBreachedPasswords(writeBreachedFile(t, tt.lines...)); err == nil {
+				t.Error("se esperaba un error")
+			}
+		})
+	}
+
+	if _, err := LoadBreachedPasswords(filepath.Join(t.TempDir(), "no-existe.txt")); err == nil {
+		t.Error("archivo inexistente: se esperaba un error")
+	}
+}
@@ -0,0 +1,34 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewOpaqueToken genera un token aleatorio de n bytes codificado en base64 URL
+func NewOpaqueToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// NewRandomID genera un identificador aleatorio de 128 bits en hexadecimal
+func NewRandomID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken devuelve el hash SHA-256 (en hexadecimal) de un token opaco.
+// Los tokens se guardan siempre hasheados para que una fuga de la base de
+// datos no permita reutilizarlos.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
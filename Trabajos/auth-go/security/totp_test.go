@@ -0,0 +1,113 @@
+package security
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Secreto de los vectores de prueba de RFC 6238 ("12345678901234567890" en base32)
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	// Vectores SHA-1 de RFC 6238, apéndice B, con los 6 últimos dígitos
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, time.Unix(v.unix, 0), 0)
+		if !ok || step != v.unix/totpPeriod {
+			t.Errorf("T=%d: ValidateTOTP(%s) = %d, %v; se esperaba el paso %d", v.unix, v.code, step, ok, v.unix/totpPeriod)
+		}
+	}
+
+	// 1111111111 cae en el paso 37037037; 1111111109 en el anterior
+	at := time.Unix(1111111111, 0)
+	const current, previous = int64(37037037), int64(37037036)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      time.Time
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"paso actual", rfc6238Secret, "050471", at, 0, current, true},
+		{"paso anterior dentro de la tolerancia", rfc6238Secret, "081804", at, 0, previous, true},
+		{"paso siguiente dentro de la tolerancia", rfc6238Secret, "081804", at.Add(-2 * totpPeriod * time.Second), 0, previous, true},
+		{"dos pasos atrás", rfc6238Secret, "081804", at.Add(2 * totpPeriod * time.Second), 0, 0, false},
+		{"secreto en minúsculas", strings.ToLower(rfc6238Secret), "050471", at, 0, current, true},
+		{"paso ya usado", rfc6238Secret, "050471", at, current, 0, false},
+		{"paso anterior al último usado", rfc6238Secret, "081804", at, previous, 0, false},
+		{"paso posterior al último usado", rfc6238Secret, "050471", at, previous, current, true},
+		{"código incorrecto", rfc6238Secret, "000000", at, 0, 0, false},
+		{"código corto", rfc6238Secret, "50471", at, 0, 0, false},
+		{"código de 8 dígitos", rfc6238Secret, "14050471", at, 0, 0, false},
+		{"secreto inválido", "no-es-base32!", "050471", at, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, tt.now, tt.lastStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("ValidateTOTP = %d, %v; se esperaba %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secreto %q: %d bytes, %v; se esperaban 20 bytes en base32", secret, len(key), err)
+	}
+
+	// El código que calcularía una aplicación con el secreto es válido
+	now := time.Now()
+	if _, ok := ValidateTOTP(secret, totpCode(key, now.Unix()/totpPeriod), now, 0); !ok {
+		t.Error("el código del paso actual no es válido")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	got := TOTPURI("Mi Servicio", "maría", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/Mi%20Servicio:mar%C3%ADa?algorithm=SHA1&digits=6&issuer=Mi%20Servicio&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Errorf("TOTPURI = %q, se esperaba %q", got, want)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("%d códigos, se esperaban 10", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || strings.ContainsAny(code, "ilo1") {
+			t.Errorf("código %q sin el formato xxxxx-xxxxx del alfabeto sin ambigüedades", code)
+		}
+		if seen[code] {
+			t.Errorf("código %q repetido", code)
+		}
+		seen[code] = true
+	}
+}
@@ -0,0 +1,334 @@
+package store
+
+import (
+	"auth/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryUser es un usuario guardado en memoria junto con su estado TOTP
+type memoryUser struct {
+	user models.User
+	totp TOTPState
+}
+
+// MemoryUserStore guarda los usuarios en memoria. Los datos se pierden al
+// reiniciar; está pensado para desarrollo local y pruebas. Como en MySQL, los
+// nombres de usuario y correos se comparan sin distinguir mayúsculas.
+type MemoryUserStore struct {
+	mu     sync.RWMutex
+	users  map[int]*memoryUser
+	nextID int
+}
+
+// NewMemoryUserStore crea un almacén de usuarios en memoria vacío
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{users: map[int]*memoryUser{}, nextID: 1}
+}
+
+func (s *MemoryUserStore) Create(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	username, email := models.NormalizeUsername(user.Username), models.NormalizeEmail(user.Email)
+	for _, existing := range s.users {
+		if strings.EqualFold(existing.user.Username, username) || existing.user.Email == email {
+			return ErrUserExists
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	// Solo se guardan los mismos campos que en la base de datos; el resto toma su valor inicial
+	created := models.User{
+		ID:        s.nextID,
+		Username:  username,
+		Email:     email,
+		Password:  user.Password,
+		Role:      user.Role,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.nextID++
+
+	s.users[created.ID] = &memoryUser{user: created}
+	*user = created
+	return nil
+}
+
+func (s *MemoryUserStore) FindByID(id int) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+	return stored.user, nil
+}
+
+func (s *MemoryUserStore) FindByUsername(username string) (models.User, error) {
+	username = models.NormalizeUsername(username)
+	return s.findBy(func(user models.User) bool { return strings.EqualFold(user.Username, username) })
+}
+
+func (s *MemoryUserStore) FindByEmail(email string) (models.User, error) {
+	email = models.NormalizeEmail(email)
+	return s.findBy(func(user models.User) bool { return user.Email == email })
+}
+
+// findBy devuelve el primer usuario que cumple match
+func (s *MemoryUserStore) findBy(match func(models.User) bool) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, stored := range s.users {
+		if match(stored.user) {
+			return stored.user, nil
+		}
+	}
+	return models.User{}, ErrUserNotFound
+}
+
+func (s *MemoryUserStore) List(filter UserFilter, limit, offset int) ([]models.User, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []models.User
+	for _, stored := range s.users {
+		user := stored.user
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		if filter.Email != "" && !strings.Contains(strings.ToLower(user.Email), strings.ToLower(filter.Email)) {
+			continue
+		}
+		if !filter.CreatedFrom.IsZero() && user.CreatedAt.Before(filter.CreatedFrom) {
+			continue
+		}
+		if !filter.CreatedTo.IsZero() && user.CreatedAt.After(filter.CreatedTo) {
+			continue
+		}
+		matches = append(matches, user)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	users := []models.User{}
+	if offset < len(matches) {
+		end := min(offset+limit, len(matches))
+		users = append(users, matches[offset:end]...)
+	}
+	return users, len(matches), nil
+}
+
+func (s *MemoryUserStore) CountByRole(role string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, stored := range s.users {
+		if stored.user.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// update aplica fn al usuario bajo el bloqueo y actualiza updated_at
+func (s *MemoryUserStore) update(id int, fn func(stored *memoryUser)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	fn(stored)
+	stored.user.TOTPEnabled = stored.totp.Enabled
+	stored.user.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+func (s *MemoryUserStore) UpdateRole(id int, role string) error {
+	return s.update(id, func(stored *memoryUser) { stored.user.Role = role })
+}
+
+func (s *MemoryUserStore) SetDisabled(id int, disabled bool) error {
+	return s.update(id, func(stored *memoryUser) { stored.user.Disabled = disabled })
+}
+
+func (s *MemoryUserStore) SetMustResetPassword(id int, mustReset bool) error {
+	return s.update(id, func(stored *memoryUser) { stored.user.MustResetPassword = mustReset })
+}
+
+func (s *MemoryUserStore) UpdatePassword(id int, passwordHash string) error {
+	return s.update(id, func(stored *memoryUser) {
+		stored.user.Password = passwordHash
+		stored.user.MustResetPassword = false
+	})
+}
+
+func (s *MemoryUserStore) RehashPassword(id int, oldHash, newHash string) (bool, error) {
+	replaced := false
+	err := s.update(id, func(stored *memoryUser) {
+		if stored.user.Password == oldHash {
+			stored.user.Password = newHash
+			replaced = true
+		}
+	})
+	return replaced, err
+}
+
+func (s *MemoryUserStore) MarkEmailVerified(id int, email string) (bool, error) {
+	verified := false
+	err := s.update(id, func(stored *memoryUser) {
+		if strings.EqualFold(stored.user.Email, email) {
+			stored.user.EmailVerified = true
+			verified = true
+		}
+	})
+	return verified, err
+}
+
+func (s *MemoryUserStore) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+func (s *MemoryUserStore) UpdateUsername(id int, username string) error {
+	username = models.NormalizeUsername(username)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if s.inUse(id, func(user models.User) bool { return strings.EqualFold(user.Username, username) }) {
+		return ErrUserExists
+	}
+
+	stored.user.Username = username
+	stored.user.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	return nil
+}
+
+func (s *MemoryUserStore) SetPendingEmail(id int, email string) error {
+	email = models.NormalizeEmail(email)
+	return s.update(id, func(stored *memoryUser) { stored.user.PendingEmail = email })
+}
+
+func (s *MemoryUserStore) ConfirmEmailChange(id int, newEmail string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[id]
+	if !ok || stored.user.PendingEmail == "" || stored.user.PendingEmail != newEmail {
+		return false, nil
+	}
+	if s.inUse(id, func(user models.User) bool { return strings.EqualFold(user.Email, newEmail) }) {
+		return false, ErrUserExists
+	}
+
+	stored.user.Email = newEmail
+	stored.user.EmailVerified = true
+	stored.user.PendingEmail = ""
+	stored.user.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	return true, nil
+}
+
+func (s *MemoryUserStore) RestoreEmail(id int, changedEmail, oldEmail string, verified bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[id]
+	if !ok || !strings.EqualFold(stored.user.Email, changedEmail) {
+		return false, nil
+	}
+	if s.inUse(id, func(user models.User) bool { return strings.EqualFold(user.Email, oldEmail) }) {
+		return false, ErrUserExists
+	}
+
+	stored.user.Email = oldEmail
+	stored.user.EmailVerified = verified
+	stored.user.PendingEmail = ""
+	stored.user.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	return true, nil
+}
+
+// inUse indica si otro usuario distinto de id cumple match. Debe llamarse con el bloqueo tomado.
+func (s *MemoryUserStore) inUse(id int, match func(models.User) bool) bool {
+	for otherID, other := range s.users {
+		if otherID != id && match(other.user) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryUserStore) ScheduleDeletion(id int, deleteAfter time.Time) error {
+	deleteAfter = deleteAfter.UTC().Truncate(time.Second)
+	return s.update(id, func(stored *memoryUser) { stored.user.DeleteAfter = &deleteAfter })
+}
+
+func (s *MemoryUserStore) CancelDeletion(id int) error {
+	return s.update(id, func(stored *memoryUser) { stored.user.DeleteAfter = nil })
+}
+
+func (s *MemoryUserStore) PurgeDeleted(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, stored := range s.users {
+		if stored.user.DeleteAfter != nil && !stored.user.DeleteAfter.After(now) {
+			delete(s.users, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *MemoryUserStore) GetTOTP(id int) (TOTPState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.users[id]
+	if !ok {
+		return TOTPState{}, ErrUserNotFound
+	}
+	return stored.totp, nil
+}
+
+func (s *MemoryUserStore) SetPendingTOTPSecret(id int, secret string) error {
+	return s.update(id, func(stored *memoryUser) { stored.totp = TOTPState{Secret: secret} })
+}
+
+func (s *MemoryUserStore) EnableTOTP(id int, step int64) error {
+	return s.update(id, func(stored *memoryUser) {
+		stored.totp.Enabled = true
+		stored.totp.LastStep = step
+	})
+}
+
+func (s *MemoryUserStore) DisableTOTP(id int) error {
+	return s.update(id, func(stored *memoryUser) { stored.totp = TOTPState{} })
+}
+
+func (s *MemoryUserStore) AdvanceTOTPStep(id int, step int64) (bool, error) {
+	advanced := false
+	err := s.update(id, func(stored *memoryUser) {
+		if stored.totp.LastStep < step {
+			stored.totp.LastStep = step
+			advanced = true
+		}
+	})
+	return advanced, err
+}
@@ -0,0 +1,19 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// NewMySQLUserStore crea un UserStore sobre una base de datos MySQL
+func NewMySQLUserStore(database *sql.DB) UserStore {
+	return &sqlUserStore{db: database, isDuplicate: isMySQLDuplicate}
+}
+
+// isMySQLDuplicate indica si el error es una violación de una clave única (ER_DUP_ENTRY)
+func isMySQLDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"log"
+	"time"
+)
+
+// StartDeletionPurge elimina periódicamente las cuentas cuyo periodo de
+// gracia para cancelar la eliminación ya venció
+func StartDeletionPurge(users UserStore, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := users.PurgeDeleted(time.Now())
+			if err != nil {
+				log.Printf("Error al eliminar las cuentas vencidas: %v", err)
+			} else if purged > 0 {
+				log.Printf("Cuentas eliminadas definitivamente: %d", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,339 @@
+package store
+
+import (
+	"auth/models"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// userColumns son las columnas que se leen al cargar un usuario completo
+const userColumns = "id, username, email, COALESCE(pending_email, ''), password, role, email_verified, totp_enabled, disabled, must_reset_password, delete_after, created_at, updated_at"
+
+// sqlUserStore implementa UserStore sobre la tabla users. Las consultas son
+// comunes a MySQL y SQLite; cada motor indica cómo reconocer un duplicado.
+type sqlUserStore struct {
+	db          *sql.DB
+	isDuplicate func(err error) bool
+}
+
+// scanUser lee un usuario con las columnas de userColumns
+func scanUser(row interface{ Scan(...any) error }) (models.User, error) {
+	var user models.User
+	var deleteAfter sql.NullTime
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PendingEmail,
+		&user.Password,
+		&user.Role,
+		&user.EmailVerified,
+		&user.TOTPEnabled,
+		&user.Disabled,
+		&user.MustResetPassword,
+		&deleteAfter,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return user, ErrUserNotFound
+	}
+	if deleteAfter.Valid {
+		user.DeleteAfter = &deleteAfter.Time
+	}
+	return user, err
+}
+
+func (s *sqlUserStore) Create(user *models.User) error {
+	result, err := s.db.Exec(
+		"INSERT INTO users (username, email, password, role) VALUES (?, ?, ?, ?)",
+		models.NormalizeUsername(user.Username), models.NormalizeEmail(user.Email), user.Password, user.Role,
+	)
+	if err != nil {
+		if s.isDuplicate(err) {
+			return ErrUserExists
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	// Releer el usuario para obtener las fechas y los valores por defecto
+	created, err := s.FindByID(int(id))
+	if err != nil {
+		return err
+	}
+	*user = created
+	return nil
+}
+
+func (s *sqlUserStore) FindByID(id int) (models.User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (s *sqlUserStore) FindByUsername(username string) (models.User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = ?", models.NormalizeUsername(username)))
+}
+
+func (s *sqlUserStore) FindByEmail(email string) (models.User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email = ?", models.NormalizeEmail(email)))
+}
+
+func (s *sqlUserStore) List(filter UserFilter, limit, offset int) ([]models.User, int, error) {
+	// Construir los filtros de la consulta
+	var conditions []string
+	var args []any
+
+	if filter.Role != "" {
+		conditions = append(conditions, "role = ?")
+		args = append(args, filter.Role)
+	}
+	if filter.Email != "" {
+		conditions = append(conditions, "email LIKE ? ESCAPE '!'")
+		args = append(args, "%"+escapeLike(filter.Email)+"%")
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.CreatedFrom.UTC())
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, filter.CreatedTo.UTC())
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Contar el total de usuarios que cumplen los filtros
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Obtener la página solicitada
+	rows, err := s.db.Query(
+		"SELECT "+userColumns+" FROM users"+where+" ORDER BY id LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+func (s *sqlUserStore) CountByRole(role string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", role).Scan(&count)
+	return count, err
+}
+
+// update modifica las columnas indicadas en set del usuario y devuelve
+// ErrUserNotFound si no existe
+func (s *sqlUserStore) update(id int, set string, args ...any) error {
+	result, err := s.db.Exec("UPDATE users SET "+set+" WHERE id = ?", append(args, id)...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		// MySQL no cuenta las filas que no cambian: comprobar si el usuario existe
+		if _, err := s.FindByID(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlUserStore) UpdateRole(id int, role string) error {
+	return s.update(id, "role = ?", role)
+}
+
+func (s *sqlUserStore) SetDisabled(id int, disabled bool) error {
+	return s.update(id, "disabled = ?", disabled)
+}
+
+func (s *sqlUserStore) SetMustResetPassword(id int, mustReset bool) error {
+	return s.update(id, "must_reset_password = ?", mustReset)
+}
+
+func (s *sqlUserStore) UpdatePassword(id int, passwordHash string) error {
+	return s.update(id, "password = ?, must_reset_password = FALSE", passwordHash)
+}
+
+func (s *sqlUserStore) RehashPassword(id int, oldHash, newHash string) (bool, error) {
+	result, err := s.db.Exec("UPDATE users SET password = ? WHERE id = ? AND password = ?", newHash, id, oldHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (s *sqlUserStore) MarkEmailVerified(id int, email string) (bool, error) {
+	result, err := s.db.Exec("UPDATE users SET email_verified = TRUE WHERE id = ? AND email = ?", id, email)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows == 1 {
+		return true, nil
+	}
+
+	// Sin filas afectadas el correo cambió o ya estaba verificado
+	user, err := s.FindByID(id)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified && strings.EqualFold(user.Email, email), nil
+}
+
+func (s *sqlUserStore) Delete(id int) error {
+	// Los datos asociados (tokens, sesiones, etc.) se eliminan en cascada
+	result, err := s.db.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *sqlUserStore) UpdateUsername(id int, username string) error {
+	err := s.update(id, "username = ?", models.NormalizeUsername(username))
+	if err != nil && s.isDuplicate(err) {
+		return ErrUserExists
+	}
+	return err
+}
+
+func (s *sqlUserStore) SetPendingEmail(id int, email string) error {
+	if email == "" {
+		return s.update(id, "pending_email = NULL")
+	}
+	return s.update(id, "pending_email = ?", models.NormalizeEmail(email))
+}
+
+func (s *sqlUserStore) ConfirmEmailChange(id int, newEmail string) (bool, error) {
+	return s.updateIf(
+		"email = pending_email, email_verified = TRUE, pending_email = NULL",
+		"id = ? AND pending_email = ?", id, newEmail,
+	)
+}
+
+func (s *sqlUserStore) RestoreEmail(id int, changedEmail, oldEmail string, verified bool) (bool, error) {
+	return s.updateIf(
+		"email = ?, email_verified = ?, pending_email = NULL",
+		"id = ? AND email = ?", oldEmail, verified, id, changedEmail,
+	)
+}
+
+// updateIf modifica las columnas de set en las filas que cumplen where e
+// indica si se modificó alguna. Los correos repetidos devuelven ErrUserExists.
+func (s *sqlUserStore) updateIf(set, where string, args ...any) (bool, error) {
+	result, err := s.db.Exec("UPDATE users SET "+set+" WHERE "+where, args...)
+	if err != nil {
+		if s.isDuplicate(err) {
+			return false, ErrUserExists
+		}
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (s *sqlUserStore) ScheduleDeletion(id int, deleteAfter time.Time) error {
+	return s.update(id, "delete_after = ?", deleteAfter.UTC())
+}
+
+func (s *sqlUserStore) CancelDeletion(id int) error {
+	return s.update(id, "delete_after = NULL")
+}
+
+func (s *sqlUserStore) PurgeDeleted(now time.Time) (int, error) {
+	// Los datos asociados se eliminan en cascada, igual que en Delete
+	result, err := s.db.Exec("DELETE FROM users WHERE delete_after IS NOT NULL AND delete_after <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
+
+func (s *sqlUserStore) GetTOTP(id int) (TOTPState, error) {
+	var state TOTPState
+	var secret sql.NullString
+	err := s.db.QueryRow(
+		"SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ?",
+		id,
+	).Scan(&secret, &state.Enabled, &state.LastStep)
+	if err == sql.ErrNoRows {
+		return state, ErrUserNotFound
+	}
+	state.Secret = secret.String
+	return state, err
+}
+
+func (s *sqlUserStore) SetPendingTOTPSecret(id int, secret string) error {
+	return s.update(id, "totp_secret = ?, totp_enabled = FALSE, totp_last_step = 0", secret)
+}
+
+func (s *sqlUserStore) EnableTOTP(id int, step int64) error {
+	return s.update(id, "totp_enabled = TRUE, totp_last_step = ?", step)
+}
+
+func (s *sqlUserStore) DisableTOTP(id int) error {
+	return s.update(id, "totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0")
+}
+
+func (s *sqlUserStore) AdvanceTOTPStep(id int, step int64) (bool, error) {
+	result, err := s.db.Exec(
+		"UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?",
+		step, id, step,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// escapeLike escapa los comodines de LIKE usando '!' como carácter de escape
+func escapeLike(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+}
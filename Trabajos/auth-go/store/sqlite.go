@@ -0,0 +1,20 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// NewSQLiteUserStore crea un UserStore sobre una base de datos SQLite
+func NewSQLiteUserStore(database *sql.DB) UserStore {
+	return &sqlUserStore{db: database, isDuplicate: isSQLiteDuplicate}
+}
+
+// isSQLiteDuplicate indica si el error es una violación de una restricción UNIQUE
+func isSQLiteDuplicate(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
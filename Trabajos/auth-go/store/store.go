@@ -0,0 +1,110 @@
+package store
+
+import (
+	"auth/config"
+	"auth/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Errores devueltos por los almacenes de usuarios
+var (
+	ErrUserNotFound = errors.New("usuario no encontrado")
+	ErrUserExists   = errors.New("el nombre de usuario o correo electrónico ya está en uso")
+)
+
+// UserFilter son los filtros opcionales del listado de usuarios. Los campos
+// vacíos no filtran.
+type UserFilter struct {
+	Role        string
+	Email       string // Coincidencia parcial
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+// TOTPState es el estado de la autenticación en dos pasos de un usuario
+type TOTPState struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// UserStore guarda las cuentas de usuario. Los métodos que reciben un ID
+// devuelven ErrUserNotFound si el usuario no existe. Los nombres de usuario y
+// correos se normalizan (models.NormalizeUsername y models.NormalizeEmail)
+// tanto al guardarlos como al buscarlos.
+type UserStore interface {
+	// Create guarda un usuario nuevo (con la contraseña ya cifrada) y
+	// completa su ID y fechas. Devuelve ErrUserExists si el nombre de
+	// usuario o el correo ya están en uso.
+	Create(user *models.User) error
+	FindByID(id int) (models.User, error)
+	FindByUsername(username string) (models.User, error)
+	FindByEmail(email string) (models.User, error)
+	// List devuelve una página de usuarios ordenados por ID y el total que cumple los filtros
+	List(filter UserFilter, limit, offset int) ([]models.User, int, error)
+	CountByRole(role string) (int, error)
+
+	UpdateRole(id int, role string) error
+	SetDisabled(id int, disabled bool) error
+	SetMustResetPassword(id int, mustReset bool) error
+	// UpdatePassword reemplaza el hash de la contraseña y quita la obligación de restablecerla
+	UpdatePassword(id int, passwordHash string) error
+	// RehashPassword reemplaza el hash de la misma contraseña (cifrada con
+	// parámetros nuevos) si el guardado sigue siendo oldHash. Devuelve false si
+	// la contraseña cambió mientras tanto.
+	RehashPassword(id int, oldHash, newHash string) (bool, error)
+	// MarkEmailVerified marca el correo como verificado si el usuario sigue
+	// teniendo ese correo. Devuelve false si el correo cambió.
+	MarkEmailVerified(id int, email string) (bool, error)
+	Delete(id int) error
+
+	// UpdateUsername cambia el nombre de usuario. Devuelve ErrUserExists si
+	// ya está en uso por otro usuario.
+	UpdateUsername(id int, username string) error
+	// SetPendingEmail guarda el correo nuevo pendiente de confirmar (vacío lo quita)
+	SetPendingEmail(id int, email string) error
+	// ConfirmEmailChange reemplaza el correo por el pendiente, ya verificado,
+	// si el pendiente sigue siendo newEmail. Devuelve false si cambió y
+	// ErrUserExists si el correo ya está en uso por otro usuario.
+	ConfirmEmailChange(id int, newEmail string) (bool, error)
+	// RestoreEmail deshace un cambio de correo: si el correo sigue siendo
+	// changedEmail, vuelve a oldEmail con el estado de verificación indicado.
+	// Devuelve false si el correo cambió desde entonces.
+	RestoreEmail(id int, changedEmail, oldEmail string, verified bool) (bool, error)
+	// ScheduleDeletion programa la eliminación definitiva de la cuenta
+	ScheduleDeletion(id int, deleteAfter time.Time) error
+	// CancelDeletion cancela la eliminación programada
+	CancelDeletion(id int) error
+	// PurgeDeleted elimina las cuentas cuya eliminación vence antes de now y
+	// devuelve cuántas se eliminaron
+	PurgeDeleted(now time.Time) (int, error)
+
+	GetTOTP(id int) (TOTPState, error)
+	// SetPendingTOTPSecret guarda un secreto TOTP todavía sin confirmar
+	SetPendingTOTPSecret(id int, secret string) error
+	EnableTOTP(id int, step int64) error
+	// DisableTOTP desactiva TOTP y elimina el secreto
+	DisableTOTP(id int) error
+	// AdvanceTOTPStep registra el último paso TOTP usado. Devuelve false si ese
+	// paso (o uno posterior) ya se había usado, es decir, si el código se reutilizó.
+	AdvanceTOTPStep(id int, step int64) (bool, error)
+}
+
+// New crea el UserStore indicado en la configuración (DB_DRIVER). Con mysql
+// y sqlite los usuarios se guardan en la base de datos abierta; con memory
+// se guardan en memoria y se pierden al reiniciar.
+func New(cfg config.Config, database *sql.DB) (UserStore, error) {
+	switch cfg.DBDriver {
+	case "mysql":
+		return NewMySQLUserStore(database), nil
+	case "sqlite":
+		return NewSQLiteUserStore(database), nil
+	case "memory":
+		return NewMemoryUserStore(), nil
+	default:
+		return nil, fmt.Errorf("DB_DRIVER desconocido: %q", cfg.DBDriver)
+	}
+}
@@ -0,0 +1,109 @@
+package store_test
+
+import (
+	"auth/config"
+	"auth/db"
+	"auth/models"
+	"auth/store"
+	"testing"
+)
+
+// testStores devuelve los almacenes que se prueban: el de memoria y el de
+// SQLite sobre una base de datos en memoria con las migraciones aplicadas
+func testStores() map[string]func(t *testing.T) store.UserStore {
+	return map[string]func(t *testing.T) store.UserStore{
+		"memory": func(t *testing.T) store.UserStore {
+			return store.NewMemoryUserStore()
+		},
+		"sqlite": func(t *testing.T) store.UserStore {
+			if err := db.Connect(config.Config{DBDriver: "sqlite", SQLitePath: ":memory:"}); err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+			t.Cleanup(func() { db.Database.Close() })
+			if _, err := db.MigrateUp(); err != nil {
+				t.Fatalf("MigrateUp: %v", err)
+			}
+			return store.NewSQLiteUserStore(db.Database)
+		},
+	}
+}
+
+func TestUserStoreIdentities(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		email    string
+		wantErr  error
+	}{
+		{"usuario distinto", "luis", "luis@example.com", nil},
+		{"mismo nombre", "ana", "otra@example.com", store.ErrUserExists},
+		{"nombre con otras mayúsculas", "ANA", "otra@example.com", store.ErrUserExists},
+		{"nombre de ancho completo (NFKC)", "ａｎａ", "otra@example.com", store.ErrUserExists},
+		{"nombre con espacios", "  ana ", "otra@example.com", store.ErrUserExists},
+		{"mismo correo con mayúsculas y espacios", "otra", " ANA@Example.COM ", store.ErrUserExists},
+	}
+
+	for storeName, open := range testStores() {
+		t.Run(storeName, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					users := open(t)
+					ana := models.User{Username: "ana", Email: "ana@example.com", Password: "hash", Role: models.RoleUser}
+					if err := users.Create(&ana); err != nil {
+						t.Fatalf("Create: %v", err)
+					}
+
+					user := models.User{Username: tt.username, Email: tt.email, Password: "hash", Role: models.RoleUser}
+					if err := users.Create(&user); err != tt.wantErr {
+						t.Fatalf("Create(%q, %q): error = %v, se esperaba %v", tt.username, tt.email, err, tt.wantErr)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestUserStoreLookups(t *testing.T) {
+	for storeName, open := range testStores() {
+		t.Run(storeName, func(t *testing.T) {
+			users := open(t)
+			created := models.User{Username: " Ｍaria ", Email: " Maria@Example.com", Password: "hash", Role: models.RoleUser}
+			if err := users.Create(&created); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if created.ID == 0 || created.Username != "Maria" || created.Email != "maria@example.com" {
+				t.Fatalf("usuario creado = %+v", created)
+			}
+
+			tests := []struct {
+				name    string
+				find    func() (models.User, error)
+				wantErr error
+			}{
+				{"por ID", func() (models.User, error) { return users.FindByID(created.ID) }, nil},
+				{"por nombre normalizado", func() (models.User, error) { return users.FindByUsername("Maria") }, nil},
+				{"por nombre de ancho completo", func() (models.User, error) { return users.FindByUsername("Ｍａｒｉａ") }, nil},
+				{"por correo con mayúsculas", func() (models.User, error) { return users.FindByEmail("MARIA@example.com ") }, nil},
+				{"ID inexistente", func() (models.User, error) { return users.FindByID(created.ID + 100) }, store.ErrUserNotFound},
+				{"nombre inexistente", func() (models.User, error) { return users.FindByUsername("mario") }, store.ErrUserNotFound},
+				{"correo inexistente", func() (models.User, error) { return users.FindByEmail("mario@example.com") }, store.ErrUserNotFound},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					user, err := tt.find()
+					if err != tt.wantErr {
+						t.Fatalf("error = %v, se esperaba %v", err, tt.wantErr)
+					}
+					if err == nil && user.ID != created.ID {
+						t.Errorf("se encontró el usuario %d, se esperaba %d", user.ID, created.ID)
+					}
+				})
+			}
+
+			if err := users.UpdateRole(created.ID+100, models.RoleAdmin); err != store.ErrUserNotFound {
+				t.Errorf("UpdateRole de un ID inexistente: error = %v, se esperaba %v", err, store.ErrUserNotFound)
+			}
+		})
+	}
+}